@@ -0,0 +1,300 @@
+package api
+
+import (
+	"QADots/bot_data"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var Token = flag.String("api.token", "", "bearer token required by /api/v1, empty disables the check and closes private communities")
+
+// Prefix - путь, под которым обслуживается API.
+const Prefix = "/api/v1/"
+
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Store - источник данных API. Его реализует bot_data.Bot.
+type Store interface {
+	ListQuestions(f bot_data.QuestionFilter) ([]bot_data.QuestionSummary, int, error)
+	Question(communityID, questionID int64) (bot_data.QuestionDetail, error)
+	ListTags(communityID int64, limit, offset int) ([]bot_data.TagSummary, int, error)
+	UserProfile(communityID, userID int64) (bot_data.UserProfile, error)
+	ListAudit(f bot_data.AuditFilter) ([]bot_data.AuditEntry, int, error)
+}
+
+// Page - страница списка.
+type Page struct {
+	Items   interface{} `json:"items"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"per_page"`
+	Total   int         `json:"total"`
+}
+
+// Error - тело ответа с ошибкой.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type handler struct {
+	store Store
+}
+
+// NewHandler возвращает обработчик всех путей /api/v1.
+func NewHandler(s Store) http.Handler {
+	h := &handler{store: s}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+Prefix+"openapi.json", h.openAPI)
+	mux.Handle("GET "+Prefix+"questions", authorized(h.questions))
+	mux.Handle("GET "+Prefix+"questions/{id}", authorized(h.question))
+	mux.Handle("GET "+Prefix+"tags", authorized(h.tags))
+	mux.Handle("GET "+Prefix+"users/{id}", authorized(h.user))
+	mux.Handle("GET "+Prefix+"audit", tokenRequired(h.audit))
+	mux.HandleFunc(Prefix, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", "unknown endpoint")
+	})
+	return mux
+}
+
+// authorized проверяет токен из заголовка Authorization, если он задан флагом.
+func authorized(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if *Token != "" && r.Header.Get("Authorization") != "Bearer "+*Token {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid bearer token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// tokenRequired закрывает путь, если токен не задан: журнал аудита
+// не отдаётся без авторизации.
+func tokenRequired(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if *Token == "" {
+			writeError(w, http.StatusForbidden, "forbidden", "this endpoint requires the bot to run with -api.token")
+			return
+		}
+		authorized(next).ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("ошибка записи ответа API: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]Error{"error": {Code: code, Message: message}})
+}
+
+// writeStoreError отвечает на ошибку хранилища: ErrNotFound - 404, остальное - 500.
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, bot_data.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "not_found", "not found")
+		return
+	}
+	log.Printf("ошибка API: %v", err)
+	writeError(w, http.StatusInternalServerError, "internal", "internal error")
+}
+
+// intParam читает неотрицательное целое из строки запроса.
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, errors.New(name + " must be a non-negative integer")
+	}
+	return n, nil
+}
+
+// pagination читает page и per_page и возвращает их вместе с limit и offset.
+func pagination(r *http.Request) (page, perPage int, err error) {
+	if page, err = intParam(r, "page", 1); err != nil {
+		return
+	}
+	if perPage, err = intParam(r, "per_page", defaultPerPage); err != nil {
+		return
+	}
+	if page < 1 {
+		err = errors.New("page must be positive")
+	}
+	if perPage < 1 || perPage > maxPerPage {
+		err = errors.New("per_page must be between 1 and " + strconv.Itoa(maxPerPage))
+	}
+	return
+}
+
+// errCommunityForbidden - без токена API отдаёт только общее пространство:
+// иначе вопросы закрытых сообществ мог бы прочитать кто угодно.
+var errCommunityForbidden = errors.New("community other than 0 requires the bot to run with -api.token")
+
+func community(r *http.Request) (int64, error) {
+	n, err := intParam(r, "community", 0)
+	if err == nil && n != 0 && *Token == "" {
+		return 0, errCommunityForbidden
+	}
+	return int64(n), err
+}
+
+// writeParamError отвечает на ошибку в параметрах запроса.
+func writeParamError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errCommunityForbidden) {
+		writeError(w, http.StatusForbidden, "forbidden", err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+}
+
+func pathID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("id must be a positive integer")
+	}
+	return id, nil
+}
+
+func (h *handler) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(openAPI)
+}
+
+func (h *handler) questions(w http.ResponseWriter, r *http.Request) {
+	page, perPage, err := pagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	c, err := community(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+	order := r.URL.Query().Get("sort")
+	switch order {
+	case "", bot_data.OrderNewest, bot_data.OrderLikes, bot_data.OrderScore:
+	default:
+		writeError(w, http.StatusBadRequest, "bad_request", "sort must be new, likes or score")
+		return
+	}
+	items, total, err := h.store.ListQuestions(bot_data.QuestionFilter{
+		CommunityID: c,
+		Tag:         r.URL.Query().Get("tag"),
+		Query:       strings.TrimSpace(r.URL.Query().Get("q")),
+		Order:       order,
+		Limit:       perPage,
+		Offset:      (page - 1) * perPage,
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Page{Items: items, Page: page, PerPage: perPage, Total: total})
+}
+
+func (h *handler) question(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	c, err := community(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+	q, err := h.store.Question(c, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, q)
+}
+
+func (h *handler) tags(w http.ResponseWriter, r *http.Request) {
+	page, perPage, err := pagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	c, err := community(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+	items, total, err := h.store.ListTags(c, perPage, (page-1)*perPage)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Page{Items: items, Page: page, PerPage: perPage, Total: total})
+}
+
+func (h *handler) user(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	c, err := community(r)
+	if err != nil {
+		writeParamError(w, err)
+		return
+	}
+	p, err := h.store.UserProfile(c, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (h *handler) audit(w http.ResponseWriter, r *http.Request) {
+	page, perPage, err := pagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	f := bot_data.AuditFilter{
+		Action: r.URL.Query().Get("action"),
+		Limit:  perPage,
+		Offset: (page - 1) * perPage,
+	}
+	if v := r.URL.Query().Get("actor"); v != "" {
+		if f.ActorID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "actor must be an integer")
+			return
+		}
+	}
+	if v := r.URL.Query().Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, http.StatusBadRequest, "bad_request", "since must be an RFC 3339 time")
+			return
+		}
+	}
+	items, total, err := h.store.ListAudit(f)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Page{Items: items, Page: page, PerPage: perPage, Total: total})
+}
@@ -0,0 +1,213 @@
+package bot_data
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// UserInfo - пользователь в списке qadmin.
+type UserInfo struct {
+	ID           int64
+	Username     string
+	StatusID     int
+	Status       string
+	RegisteredAt time.Time
+	// BannedAt - время блокировки, nil если пользователь не заблокирован
+	BannedAt  *time.Time
+	Questions int
+	Answers   int
+}
+
+// UserFilter - условия выборки пользователей.
+type UserFilter struct {
+	// Banned оставляет только заблокированных пользователей
+	Banned bool
+	Limit  int
+	Offset int
+}
+
+// Stats - сводка по содержимому базы.
+type Stats struct {
+	Users            int64
+	BannedUsers      int64
+	Questions        int64
+	ClosedQuestions  int64
+	DeletedQuestions int64
+	Answers          int64
+	QuestionLikes    int64
+	AnswerLikes      int64
+	Tags             int64
+	Communities      int64
+	OutboxPending    int64
+}
+
+// ListUsers возвращает страницу пользователей по возрастанию номера и общее
+// количество подходящих пользователей.
+func (b *Bot) ListUsers(f UserFilter) ([]UserInfo, int, error) {
+	query := `
+		SELECT u.user_id, u.username, u.status_id, s.status_name, u.registration_date, u.banned_at,
+			(SELECT COUNT(*) FROM public.questions q WHERE q.user_id = u.user_id AND q.deleted_at IS NULL),
+			(SELECT COUNT(*) FROM public.answers a WHERE a.user_id = u.user_id),
+			COUNT(*) OVER ()
+		FROM public.users u
+		JOIN public.statuses s ON s.status_id = u.status_id
+		WHERE $3 = false OR u.banned_at IS NOT NULL
+		ORDER BY u.user_id
+		LIMIT $1 OFFSET $2;
+	`
+	rows, err := b.dtbase.Db.Query(query, f.Limit, f.Offset, f.Banned)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var result []UserInfo
+	total := 0
+	for rows.Next() {
+		var u UserInfo
+		if err := rows.Scan(&u.ID, &u.Username, &u.StatusID, &u.Status, &u.RegisteredAt, &u.BannedAt,
+			&u.Questions, &u.Answers, &total); err != nil {
+			return nil, 0, err
+		}
+		result = append(result, u)
+	}
+	return result, total, rows.Err()
+}
+
+// IsBanned сообщает, что пользователь заблокирован. Блокирует qadmin в другом
+// процессе, поэтому бот узнаёт о блокировке не позже чем через CacheTTL.
+func (b *Bot) IsBanned(userID int64) bool {
+	if banned, ok := b.cache.banned.Get(userID); ok {
+		return banned
+	}
+	var banned bool
+	query := "SELECT EXISTS (SELECT 1 FROM public.users WHERE user_id = $1 AND banned_at IS NOT NULL);"
+	if err := b.dtbase.Db.QueryRow(query, userID).Scan(&banned); err != nil {
+		log.Printf("Ошибка при проверке блокировки: %v", err)
+		return false
+	}
+	b.cache.banned.Set(userID, banned)
+	return banned
+}
+
+// SetBanned блокирует или разблокирует пользователя от имени actorID.
+func (b *Bot) SetBanned(actorID, userID int64, banned bool) error {
+	err := b.inTx(func(tx *sql.Tx) error {
+		var bannedAt *time.Time
+		err := tx.QueryRow("SELECT banned_at FROM public.users WHERE user_id = $1 FOR UPDATE;", userID).Scan(&bannedAt)
+		if err == sql.ErrNoRows {
+			return newError("user_not_found")
+		}
+		if err != nil {
+			return err
+		}
+		if (bannedAt != nil) == banned {
+			return nil
+		}
+		if _, err := tx.Exec("UPDATE public.users SET banned_at = CASE WHEN $2 THEN NOW() END WHERE user_id = $1;", userID, banned); err != nil {
+			return err
+		}
+		action := AuditUserBan
+		if !banned {
+			action = AuditUserUnban
+		}
+		return audit(tx, actorID, action, auditTargetUser, userID,
+			map[string]bool{"banned": !banned}, map[string]bool{"banned": banned})
+	})
+	if err != nil {
+		return err
+	}
+	b.cache.banned.Delete(userID)
+	return nil
+}
+
+// SetUserStatus меняет статус пользователя от имени actorID. Статус показывается
+// рядом с ответами, поэтому кэш ответов сбрасывается целиком.
+func (b *Bot) SetUserStatus(actorID, userID int64, statusID int) error {
+	err := b.inTx(func(tx *sql.Tx) error {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM public.statuses WHERE status_id = $1);", statusID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return newError("status_not_found", statusID)
+		}
+		var old int
+		err := tx.QueryRow("SELECT status_id FROM public.users WHERE user_id = $1 FOR UPDATE;", userID).Scan(&old)
+		if err == sql.ErrNoRows {
+			return newError("user_not_found")
+		}
+		if err != nil {
+			return err
+		}
+		if old == statusID {
+			return nil
+		}
+		if _, err := tx.Exec("UPDATE public.users SET status_id = $2 WHERE user_id = $1;", userID, statusID); err != nil {
+			return err
+		}
+		return audit(tx, actorID, AuditUserStatus, auditTargetUser, userID,
+			map[string]int{"status_id": old}, map[string]int{"status_id": statusID})
+	})
+	if err != nil {
+		return err
+	}
+	b.cache.answers.Purge()
+	return nil
+}
+
+// SetQuestionDeleted удаляет вопрос или восстанавливает удалённый от имени actorID.
+// Удалённый вопрос остаётся в базе вместе с ответами, но не виден ни в боте, ни в API.
+func (b *Bot) SetQuestionDeleted(actorID, questionID int64, deleted bool) error {
+	err := b.inTx(func(tx *sql.Tx) error {
+		var deletedAt *time.Time
+		err := tx.QueryRow("SELECT deleted_at FROM public.questions WHERE question_id = $1 FOR UPDATE;", questionID).Scan(&deletedAt)
+		if err == sql.ErrNoRows {
+			return newError("question_not_found")
+		}
+		if err != nil {
+			return err
+		}
+		if (deletedAt != nil) == deleted {
+			return nil
+		}
+		if _, err := tx.Exec("UPDATE public.questions SET deleted_at = CASE WHEN $2 THEN NOW() END WHERE question_id = $1;", questionID, deleted); err != nil {
+			return err
+		}
+		action := AuditQuestionDelete
+		if !deleted {
+			action = AuditQuestionRestore
+		}
+		return audit(tx, actorID, action, auditTargetQuestion, questionID,
+			map[string]bool{"deleted": !deleted}, map[string]bool{"deleted": deleted})
+	})
+	if err != nil {
+		return err
+	}
+	b.invalidateListings()
+	b.invalidateAnswers(questionID)
+	return nil
+}
+
+// Stats собирает сводку по базе.
+func (b *Bot) Stats() (Stats, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM public.users),
+			(SELECT COUNT(*) FROM public.users WHERE banned_at IS NOT NULL),
+			(SELECT COUNT(*) FROM public.questions WHERE deleted_at IS NULL),
+			(SELECT COUNT(*) FROM public.questions WHERE deleted_at IS NULL AND is_closed),
+			(SELECT COUNT(*) FROM public.questions WHERE deleted_at IS NOT NULL),
+			(SELECT COUNT(*) FROM public.answers),
+			(SELECT COUNT(*) FROM public.questionlikes),
+			(SELECT COUNT(*) FROM public.answerlikes),
+			(SELECT COUNT(*) FROM public.tags),
+			(SELECT COUNT(*) FROM public.communities),
+			(SELECT COUNT(*) FROM public.outbox WHERE sent_at IS NULL);
+	`
+	var s Stats
+	err := b.dtbase.Db.QueryRow(query).Scan(&s.Users, &s.BannedUsers, &s.Questions, &s.ClosedQuestions,
+		&s.DeletedQuestions, &s.Answers, &s.QuestionLikes, &s.AnswerLikes, &s.Tags, &s.Communities, &s.OutboxPending)
+	return s, err
+}
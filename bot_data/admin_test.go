@@ -0,0 +1,35 @@
+package bot_data
+
+import "testing"
+
+func TestSetUserStatus(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice, bob := testUser(1, "alice"), testUser(2, "bob")
+		b.Start(alice)
+		b.Start(bob)
+		if _, err := b.dtbase.Db.Exec("INSERT INTO public.statuses (status_id, status_name) VALUES (2, 'expert');"); err != nil {
+			t.Fatal(err)
+		}
+		qid := ask(t, b, alice, "Зачем нужен context? #go")
+		answer(t, b, bob, qid, "Для отмены и дедлайнов")
+
+		// ответы попадают в кэш вместе со статусом автора
+		answers, err := b.questionAnswers(qid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(answers) != 1 || answers[0].Status != "user" {
+			t.Fatalf("ответы до смены статуса: %+v", answers)
+		}
+
+		if err := b.SetUserStatus(alice.ID, bob.ID, 2); err != nil {
+			t.Fatal(err)
+		}
+		if answers, _ = b.questionAnswers(qid); len(answers) != 1 || answers[0].Status != "expert" {
+			t.Errorf("ответы после смены статуса: %+v", answers)
+		}
+		if err := b.SetUserStatus(alice.ID, bob.ID, 3); errorKey(err) != "status_not_found" {
+			t.Errorf("ошибка %v, ожидалась status_not_found", err)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package bot_data
+
+import (
+	"log"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+const (
+	attachmentPhoto    = "photo"
+	attachmentDocument = "document"
+
+	// maxReplyAttachments - больше вложений к одному ответу не пересылаем
+	maxReplyAttachments = 10
+)
+
+// Attachment - фото или документ, сохранённый как file_id Telegram.
+// Caption заполняется при пересылке и в базе не хранится.
+type Attachment struct {
+	Kind    string
+	FileID  string
+	Caption string
+}
+
+// MessageAttachments достаёт из сообщения фото (в наибольшем размере) и документ.
+func MessageAttachments(m *tgbotapi.Message) []Attachment {
+	var result []Attachment
+	if len(m.Photo) > 0 {
+		result = append(result, Attachment{Kind: attachmentPhoto, FileID: m.Photo[len(m.Photo)-1].FileID})
+	}
+	if m.Document != nil {
+		result = append(result, Attachment{Kind: attachmentDocument, FileID: m.Document.FileID})
+	}
+	return result
+}
+
+// CaptionAsText позволяет вызывать команды подписью к фото или документу:
+// подпись и её разметка переносятся в текст сообщения.
+func CaptionAsText(m *tgbotapi.Message) {
+	if m.Text == "" && m.Caption != "" {
+		m.Text = m.Caption
+		m.Entities = m.CaptionEntities
+	}
+}
+
+func saveAttachments(tx dbtx, column string, id int64, attachments []Attachment) error {
+	query := `INSERT INTO public.attachments (` + column + `, kind, file_id) VALUES ($1, $2, $3);`
+	for _, a := range attachments {
+		if _, err := tx.Exec(query, id, a.Kind, a.FileID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bot) loadAttachments(column string, id int64) []Attachment {
+	query := `SELECT kind, file_id FROM public.attachments WHERE ` + column + ` = $1 ORDER BY attachment_id;`
+	rows, err := b.dtbase.Db.Query(query, id)
+	if err != nil {
+		log.Printf("Ошибка при поиске вложений: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var result []Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.Kind, &a.FileID); err != nil {
+			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
+		}
+		result = append(result, a)
+	}
+	return result
+}
+
+// questionAttachments возвращает вложения вопроса с подписью для пересылки.
+func (b *Bot) questionAttachments(locale string, questionID int64) []Attachment {
+	result := b.loadAttachments("question_id", questionID)
+	for i := range result {
+		result[i].Caption = tr(locale, "attachment_question", questionID)
+	}
+	return result
+}
+
+func (b *Bot) answerAttachments(locale string, answerID int64) []Attachment {
+	result := b.loadAttachments("answer_id", answerID)
+	for i := range result {
+		result[i].Caption = tr(locale, "attachment_answer", answerID)
+	}
+	return result
+}
+
+// sendAttachments пересылает вложения по file_id, без повторной загрузки файлов.
+func (b *Bot) sendAttachments(chatID int64, attachments []Attachment) error {
+	if len(attachments) > maxReplyAttachments {
+		attachments = attachments[:maxReplyAttachments]
+	}
+	for _, a := range attachments {
+		var msg tgbotapi.Chattable
+		switch a.Kind {
+		case attachmentPhoto:
+			photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(a.FileID))
+			photo.Caption = a.Caption
+			msg = photo
+		case attachmentDocument:
+			doc := tgbotapi.NewDocument(chatID, tgbotapi.FileID(a.FileID))
+			doc.Caption = a.Caption
+			msg = doc
+		default:
+			continue
+		}
+		if _, err := b.API.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
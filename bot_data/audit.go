@@ -0,0 +1,198 @@
+package bot_data
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// Действия, которые записываются в журнал аудита
+const (
+	AuditRegister        = "user.register"
+	AuditQuestionCreate  = "question.create"
+	AuditQuestionClose   = "question.close"
+	AuditQuestionLike    = "question.like"
+	AuditAnswerCreate    = "answer.create"
+	AuditAnswerLike      = "answer.like"
+	AuditTagSubscribe    = "tag.subscribe"
+	AuditTagUnsubscribe  = "tag.unsubscribe"
+	AuditTagMerge        = "tag.merge"
+	AuditTagSynonym      = "tag.synonym"
+	AuditTagDescription  = "tag.description"
+	AuditSettingsUpdate  = "settings.update"
+	AuditCommunityCreate = "community.create"
+	AuditCommunityJoin   = "community.join"
+	AuditCommunityLeave  = "community.leave"
+	AuditCommunitySwitch = "community.switch"
+	AuditChatMode        = "chat.mode"
+	AuditWebhookAdd      = "webhook.add"
+	AuditWebhookRemove   = "webhook.remove"
+	AuditRecount         = "counters.recount"
+	AuditUserBan         = "user.ban"
+	AuditUserUnban       = "user.unban"
+	AuditUserStatus      = "user.status"
+	AuditQuestionDelete  = "question.delete"
+	AuditQuestionRestore = "question.restore"
+	AuditImport          = "data.import"
+	AuditBackup          = "data.backup"
+	AuditRestore         = "data.restore"
+)
+
+// Типы объектов, над которыми выполняются действия
+const (
+	auditTargetUser      = "user"
+	auditTargetQuestion  = "question"
+	auditTargetAnswer    = "answer"
+	auditTargetTag       = "tag"
+	auditTargetCommunity = "community"
+	auditTargetChat      = "chat"
+	auditTargetWebhook   = "webhook"
+	auditTargetImport    = "import"
+)
+
+// auditPageSize - сколько последних записей показывает /audit
+const auditPageSize = 20
+
+// AuditEntry - запись журнала аудита. Before и After - состояние объекта до
+// и после действия, если оно имеет смысл.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	ActorID    int64           `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter - условия выборки журнала. Нулевые поля не ограничивают выборку.
+type AuditFilter struct {
+	ActorID int64
+	Action  string
+	Since   time.Time
+	Limit   int
+	Offset  int
+}
+
+func auditJSON(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// audit добавляет запись в журнал. Её стоит писать в той же транзакции, что и само
+// изменение, чтобы в журнал не попадали действия, которые не были сохранены.
+func audit(tx dbtx, actorID int64, action, targetType string, targetID interface{}, before, after interface{}) error {
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO public.audit_log (actor_id, action, target_type, target_id, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6);
+	`
+	_, err = tx.Exec(query, actorID, action, targetType, fmt.Sprint(targetID), beforeJSON, afterJSON)
+	return err
+}
+
+// ListAudit возвращает страницу журнала аудита, начиная с новых записей, и общее
+// количество подходящих записей.
+func (b *Bot) ListAudit(f AuditFilter) ([]AuditEntry, int, error) {
+	var args []interface{}
+	where := []string{"true"}
+	if f.ActorID != 0 {
+		args = append(args, f.ActorID)
+		where = append(where, "actor_id = $"+strconv.Itoa(len(args)))
+	}
+	if f.Action != "" {
+		args = append(args, f.Action)
+		where = append(where, "action = $"+strconv.Itoa(len(args)))
+	}
+	if !f.Since.IsZero() {
+		args = append(args, f.Since)
+		where = append(where, "created_at >= $"+strconv.Itoa(len(args)))
+	}
+	condition := strings.Join(where, " AND ")
+
+	var total int
+	if err := b.dtbase.Db.QueryRow("SELECT COUNT(*) FROM public.audit_log WHERE "+condition+";", args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, f.Limit, f.Offset)
+	query := `
+		SELECT audit_id, actor_id, action, target_type, target_id, before, after, created_at
+		FROM public.audit_log
+		WHERE ` + condition + `
+		ORDER BY audit_id DESC
+		LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args)) + `;
+	`
+	rows, err := b.dtbase.Db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	result := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID, &before, &after, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if before != nil {
+			e.Before = before
+		}
+		if after != nil {
+			e.After = after
+		}
+		result = append(result, e)
+	}
+	return result, total, rows.Err()
+}
+
+// Audit показывает последние записи журнала аудита. Аргумент - номер пользователя
+// или название действия. Доступно администраторам.
+func (b *Bot) Audit(u *tgbotapi.User, args []string) string {
+	if !isAdmin(u.ID) {
+		return b.T(u.ID, "admins_only")
+	}
+	f := AuditFilter{Limit: auditPageSize}
+	if len(args) > 0 {
+		if id, err := strconv.ParseInt(args[0], 10, 64); err == nil {
+			f.ActorID = id
+		} else {
+			f.Action = args[0]
+		}
+	}
+	entries, total, err := b.ListAudit(f)
+	if err != nil {
+		log.Printf("Ошибка при чтении журнала аудита: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+
+	s := b.settings(u.ID)
+	if len(entries) == 0 {
+		return tr(s.Locale, "audit_empty")
+	}
+	result := tr(s.Locale, "audit_header", len(entries), total)
+	for _, e := range entries {
+		target := e.TargetType
+		if e.TargetID != "" {
+			target += " " + e.TargetID
+		}
+		result += tr(s.Locale, "audit_entry", e.ID, s.FormatTime(e.CreatedAt), e.ActorID, e.Action, target)
+	}
+	return result
+}
@@ -0,0 +1,52 @@
+package bot_data
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestAuditInTransaction проверяет, что изменение и запись о нём в журнале
+// сохраняются вместе: без журнала не сохраняется и само изменение.
+func TestAuditInTransaction(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice := testUser(1, "alice")
+		b.Start(alice)
+		b.Community_Create(alice, nil, "Команда")
+		b.Subscribe(alice, "go")
+		b.Digest(alice, "weekly")
+
+		entries, _, err := b.ListAudit(AuditFilter{ActorID: alice.ID, Limit: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actions []string
+		for _, e := range entries {
+			actions = append(actions, e.Action)
+		}
+		for _, action := range []string{AuditRegister, AuditCommunityCreate, AuditCommunityJoin, AuditCommunitySwitch, AuditSettingsUpdate} {
+			if !slices.Contains(actions, action) {
+				t.Errorf("в журнале нет %s: %v", action, actions)
+			}
+		}
+
+		exec := func(query string) {
+			t.Helper()
+			if _, err := b.dtbase.Db.Exec(query); err != nil {
+				t.Fatal(err)
+			}
+		}
+		exec("ALTER TABLE public.audit_log RENAME TO audit_log_off;")
+		defer exec("ALTER TABLE public.audit_log_off RENAME TO audit_log;")
+
+		if err := b.updateSetting(alice.ID, "locale", "en"); err == nil {
+			t.Fatal("настройка сохранена без записи в журнал")
+		}
+		if s := b.settings(alice.ID); s.Locale != "ru" {
+			t.Errorf("язык после неудачной записи в журнал: %q", s.Locale)
+		}
+		expect(t, b.Community_Switch(alice, "0"), "error_retry")
+		if s := b.settings(alice.ID); s.CommunityID == 0 {
+			t.Error("активное сообщество сменилось без записи в журнал")
+		}
+	})
+}
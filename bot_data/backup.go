@@ -0,0 +1,437 @@
+package bot_data
+
+import (
+	"QADots/database"
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Резервная копия - zip-архив: manifest.json и по файлу JSON Lines на таблицу,
+// одна строка - одна запись в виде объекта "колонка: значение". Копия снимается
+// в одной транзакции и поэтому согласована, а восстанавливается только в пустую
+// базу. Формат не зависит от драйвера: копию Postgres можно развернуть в SQLite
+// и наоборот.
+
+const (
+	backupFormat   = "qadots-backup"
+	backupVersion  = 1
+	backupManifest = "manifest.json"
+)
+
+// Типы значений колонок в резервной копии
+const (
+	backupInt   = "int"
+	backupFloat = "float"
+	backupBool  = "bool"
+	backupTime  = "time"
+	backupText  = "text"
+	// backupJSON - JSON-документ, в копии он хранится как есть, а не строкой
+	backupJSON = "json"
+)
+
+// backupTable - таблица, которая попадает в резервную копию.
+type backupTable struct {
+	name string
+	// order - ключ, по которому записи выгружаются по порядку
+	order string
+	// serial - колонка с автоинкрементом, счётчик которой нужно сдвинуть после восстановления
+	serial string
+	// generated - вычисляемые колонки, их значения не сохраняются
+	generated []string
+	// conflict - что делать с записями, которые миграции создают в пустой базе
+	conflict string
+}
+
+// backupTables - таблицы в порядке восстановления: таблица идёт после тех, на
+// которые ссылается. outbox и журнал доставки вебхуков не сохраняются: это
+// очередь и история доставки, а не данные бота.
+var backupTables = []backupTable{
+	{name: "statuses", order: "status_id", conflict: "ON CONFLICT (status_id) DO UPDATE SET status_name = EXCLUDED.status_name"},
+	{name: "users", order: "user_id"},
+	{name: "communities", order: "community_id", serial: "community_id"},
+	{name: "questions", order: "question_id", serial: "question_id", generated: []string{"score"}},
+	{name: "answers", order: "answer_id", serial: "answer_id"},
+	{name: "tags", order: "tag_id", serial: "tag_id"},
+	{name: "questiontags", order: "question_id, tag_id"},
+	{name: "tagsynonyms", order: "alias"},
+	{name: "questionlikes", order: "question_id, user_id"},
+	{name: "answerlikes", order: "answer_id, user_id"},
+	{name: "tagsubscriptions", order: "user_id, tag_id"},
+	{name: "digestsettings", order: "user_id"},
+	{name: "usersettings", order: "user_id"},
+	{name: "communitymembers", order: "community_id, user_id"},
+	{name: "chatsettings", order: "chat_id"},
+	{name: "attachments", order: "attachment_id", serial: "attachment_id"},
+	{name: "webhooks", order: "webhook_id", serial: "webhook_id"},
+	{name: "importmap", order: "source, kind, external_id"},
+	{name: "audit_log", order: "audit_id", serial: "audit_id"},
+}
+
+// BackupManifest описывает содержимое резервной копии.
+type BackupManifest struct {
+	Format        string            `json:"format"`
+	Version       int               `json:"version"`
+	SchemaVersion int               `json:"schema_version"`
+	Driver        string            `json:"driver"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Tables        []BackupTableInfo `json:"tables"`
+}
+
+type BackupTableInfo struct {
+	Name    string         `json:"name"`
+	File    string         `json:"file"`
+	Rows    int            `json:"rows"`
+	Columns []BackupColumn `json:"columns"`
+}
+
+// BackupColumn - колонка таблицы и тип её значений: int, float, bool, time, text или json.
+type BackupColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Rows возвращает общее число записей в копии.
+func (m BackupManifest) Rows() int {
+	total := 0
+	for _, t := range m.Tables {
+		total += t.Rows
+	}
+	return total
+}
+
+// backupType определяет тип значений колонки по её типу в базе.
+func backupType(databaseType string) string {
+	t := strings.ToUpper(databaseType)
+	switch {
+	// в SQLite JSON хранится в колонках BLOB
+	case strings.Contains(t, "JSON"), t == "BLOB":
+		return backupJSON
+	case strings.Contains(t, "TIMESTAMP"), strings.Contains(t, "DATE"):
+		return backupTime
+	case strings.Contains(t, "BOOL"):
+		return backupBool
+	case strings.Contains(t, "INT"), strings.Contains(t, "SERIAL"):
+		return backupInt
+	case strings.Contains(t, "FLOAT"), strings.Contains(t, "DOUBLE"), strings.Contains(t, "REAL"), strings.Contains(t, "NUMERIC"):
+		return backupFloat
+	}
+	return backupText
+}
+
+// backupValue приводит значение из базы к виду, в котором оно записывается в копию.
+func backupValue(v interface{}, typ string) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		if typ == backupJSON && json.Valid(v) {
+			return json.RawMessage(v)
+		}
+		return string(v)
+	case int64:
+		// SQLite хранит логические значения числами
+		if typ == backupBool {
+			return v != 0
+		}
+	}
+	return v
+}
+
+// Backup записывает в w резервную копию базы от имени actorID. Запись в журнал
+// аудита делается в той же транзакции, поэтому она не только читающая.
+func (b *Bot) Backup(actorID int64, w io.Writer) (BackupManifest, error) {
+	m := BackupManifest{
+		Format:    backupFormat,
+		Version:   backupVersion,
+		Driver:    b.dtbase.Driver,
+		CreatedAt: time.Now(),
+	}
+	tx, err := b.dtbase.Db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return m, err
+	}
+	defer tx.Rollback()
+	if m.SchemaVersion, err = schemaVersion(tx); err != nil {
+		return m, err
+	}
+
+	archive := zip.NewWriter(w)
+	for _, t := range backupTables {
+		info, err := backupTableRows(tx, archive, t, m.CreatedAt)
+		if err != nil {
+			return m, fmt.Errorf("таблица %s: %v", t.name, err)
+		}
+		m.Tables = append(m.Tables, info)
+	}
+	f, err := archive.CreateHeader(backupFileHeader(backupManifest, m.CreatedAt))
+	if err != nil {
+		return m, err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(m); err != nil {
+		return m, err
+	}
+	if err := archive.Close(); err != nil {
+		return m, err
+	}
+	if err := audit(tx, actorID, AuditBackup, "", "", nil, map[string]interface{}{"schema_version": m.SchemaVersion, "rows": m.Rows()}); err != nil {
+		return m, err
+	}
+	return m, tx.Commit()
+}
+
+// schemaVersion возвращает версию схемы, которую Migrate записал в базу.
+func schemaVersion(q dbtx) (int, error) {
+	var version int
+	err := q.QueryRow("SELECT version FROM public.schemaversion WHERE id = 1;").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось прочитать версию схемы: %v", err)
+	}
+	return version, nil
+}
+
+func backupFileHeader(name string, modified time.Time) *zip.FileHeader {
+	return &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified}
+}
+
+func backupTableRows(tx *sql.Tx, archive *zip.Writer, t backupTable, created time.Time) (BackupTableInfo, error) {
+	info := BackupTableInfo{Name: t.name, File: t.name + ".jsonl"}
+	rows, err := tx.Query("SELECT * FROM public." + t.name + " ORDER BY " + t.order + ";")
+	if err != nil {
+		return info, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return info, err
+	}
+	var keep []int
+	for i, c := range types {
+		if !slices.Contains(t.generated, c.Name()) {
+			keep = append(keep, i)
+			info.Columns = append(info.Columns, BackupColumn{Name: c.Name(), Type: backupType(c.DatabaseTypeName())})
+		}
+	}
+
+	f, err := archive.CreateHeader(backupFileHeader(info.File, created))
+	if err != nil {
+		return info, err
+	}
+	encoder := json.NewEncoder(f)
+	values := make([]interface{}, len(types))
+	pointers := make([]interface{}, len(types))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return info, err
+		}
+		record := make(map[string]interface{}, len(keep))
+		for j, i := range keep {
+			c := info.Columns[j]
+			record[c.Name] = backupValue(values[i], c.Type)
+		}
+		if err := encoder.Encode(record); err != nil {
+			return info, err
+		}
+		info.Rows++
+	}
+	return info, rows.Err()
+}
+
+func readBackupManifest(archive *zip.Reader) (BackupManifest, error) {
+	var m BackupManifest
+	f, err := archive.Open(backupManifest)
+	if err != nil {
+		return m, fmt.Errorf("это не резервная копия: нет %s", backupManifest)
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&m); err != nil {
+		return m, fmt.Errorf("%s: %v", backupManifest, err)
+	}
+	if m.Format != backupFormat {
+		return m, fmt.Errorf("это не резервная копия: формат %q", m.Format)
+	}
+	if m.Version > backupVersion {
+		return m, fmt.Errorf("версия копии %d новее поддерживаемой (%d)", m.Version, backupVersion)
+	}
+	return m, nil
+}
+
+// Restore восстанавливает резервную копию в пустую базу от имени actorID.
+// Копия может быть снята со схемы той же или более старой версии: колонки,
+// которых в ней нет, получают значения по умолчанию.
+func (b *Bot) Restore(actorID int64, r io.ReaderAt, size int64) (BackupManifest, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	m, err := readBackupManifest(archive)
+	if err != nil {
+		return m, err
+	}
+	current, err := schemaVersion(b.dtbase.Db)
+	if err != nil {
+		return m, err
+	}
+	if m.SchemaVersion > current {
+		return m, fmt.Errorf("копия снята со схемы версии %d, а база бота - версии %d: обновите бота", m.SchemaVersion, current)
+	}
+	saved := make(map[string]BackupTableInfo, len(m.Tables))
+	for _, t := range m.Tables {
+		saved[t.Name] = t
+	}
+
+	err = b.inTx(func(tx *sql.Tx) error {
+		for _, t := range backupTables {
+			if t.conflict != "" {
+				continue
+			}
+			var exists bool
+			if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM public." + t.name + ");").Scan(&exists); err != nil {
+				return err
+			}
+			if exists {
+				return fmt.Errorf("база не пуста: в таблице %s есть записи", t.name)
+			}
+		}
+		for _, t := range backupTables {
+			info, ok := saved[t.name]
+			if !ok {
+				continue
+			}
+			if err := restoreTable(tx, archive, t, info); err != nil {
+				return fmt.Errorf("таблица %s: %v", t.name, err)
+			}
+		}
+		if b.dtbase.Driver == database.DriverPostgres {
+			// в SQLite AUTOINCREMENT сам запоминает наибольший записанный номер
+			for _, t := range backupTables {
+				if t.serial == "" {
+					continue
+				}
+				query := `SELECT setval(pg_get_serial_sequence('public.` + t.name + `', '` + t.serial + `'), MAX(` + t.serial + `))
+					FROM public.` + t.name + ` HAVING MAX(` + t.serial + `) IS NOT NULL;`
+				if _, err := tx.Exec(query); err != nil {
+					return fmt.Errorf("таблица %s: %v", t.name, err)
+				}
+			}
+		}
+		// триггеры увеличили счётчики ещё раз при вставке лайков и ответов
+		if _, _, err := recountCounters(tx); err != nil {
+			return err
+		}
+		return audit(tx, actorID, AuditRestore, "", "", nil, map[string]interface{}{
+			"created_at": m.CreatedAt, "schema_version": m.SchemaVersion, "rows": m.Rows(),
+		})
+	})
+	if err != nil {
+		return m, err
+	}
+	b.cache = newCaches(*CacheSize, *CacheTTL)
+	return m, nil
+}
+
+func restoreTable(tx *sql.Tx, archive *zip.Reader, t backupTable, info BackupTableInfo) error {
+	// колонки, которых нет в таблице (копия с другого драйвера), пропускаются
+	rows, err := tx.Query("SELECT * FROM public." + t.name + " WHERE 1 = 0;")
+	if err != nil {
+		return err
+	}
+	existing, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	var columns []BackupColumn
+	for _, c := range info.Columns {
+		if slices.Contains(existing, c.Name) && !slices.Contains(t.generated, c.Name) {
+			columns = append(columns, c)
+		} else {
+			log.Printf("Колонки %s.%s нет в базе, её значения не восстанавливаются", t.name, c.Name)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	names := make([]string, len(columns))
+	params := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.Name
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	stmt, err := tx.Prepare("INSERT INTO public." + t.name + " (" + strings.Join(names, ", ") +
+		") VALUES (" + strings.Join(params, ", ") + ") " + t.conflict + ";")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	f, err := archive.Open(info.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	count := 0
+	args := make([]interface{}, len(columns))
+	for decoder.More() {
+		var record map[string]json.RawMessage
+		if err := decoder.Decode(&record); err != nil {
+			return fmt.Errorf("%s, запись %d: %v", info.File, count+1, err)
+		}
+		for i, c := range columns {
+			if args[i], err = restoreValue(record[c.Name], c.Type); err != nil {
+				return fmt.Errorf("%s, запись %d, %s: %v", info.File, count+1, c.Name, err)
+			}
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return fmt.Errorf("%s, запись %d: %v", info.File, count+1, err)
+		}
+		count++
+	}
+	if count != info.Rows {
+		return fmt.Errorf("%s: в описании %d записей, в файле %d", info.File, info.Rows, count)
+	}
+	return nil
+}
+
+// restoreValue приводит значение из копии к типу колонки.
+func restoreValue(raw json.RawMessage, typ string) (interface{}, error) {
+	if raw == nil || string(raw) == "null" {
+		return nil, nil
+	}
+	var err error
+	switch typ {
+	case backupJSON:
+		return []byte(raw), nil
+	case backupTime:
+		var t time.Time
+		err = json.Unmarshal(raw, &t)
+		return t, err
+	case backupInt:
+		var n int64
+		err = json.Unmarshal(raw, &n)
+		return n, err
+	case backupFloat:
+		var f float64
+		err = json.Unmarshal(raw, &f)
+		return f, err
+	case backupBool:
+		var v bool
+		err = json.Unmarshal(raw, &v)
+		return v, err
+	}
+	var v string
+	err = json.Unmarshal(raw, &v)
+	return v, err
+}
@@ -0,0 +1,125 @@
+package bot_data
+
+import (
+	"QADots/database"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	for _, driver := range testDrivers() {
+		t.Run(driver, func(t *testing.T) {
+			b := newTestBot(t, driver)
+			alice, bob := testUser(1, "alice"), testUser(2, "bob")
+			b.Start(alice)
+			b.Start(bob)
+			qid := ask(t, b, alice, "Как сделать резервную копию? #backup")
+			aid := answer(t, b, bob, qid, "Командой qadmin backup create")
+			b.Like_Question(bob, strconv.FormatInt(qid, 10))
+			b.Like_Answer(alice, strconv.FormatInt(aid, 10))
+			b.Community_Create(alice, nil, "Команда")
+			ask(t, b, alice, "Вопрос сообщества #infra")
+			if _, err := b.Import(alice.ID, "forum", 0, ImportData{
+				Questions: []ImportQuestion{{ID: "1", UserID: "x", Text: "Перенесённый вопрос", Tags: []string{"backup"}, Likes: 2}},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			var saved bytes.Buffer
+			m, err := b.Backup(alice.ID, &saved)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.SchemaVersion != database.SchemaVersion {
+				t.Errorf("версия схемы в копии %d, ожидалась %d", m.SchemaVersion, database.SchemaVersion)
+			}
+
+			restored := newTestBot(t, driver)
+			if _, err := restored.Restore(alice.ID, bytes.NewReader(saved.Bytes()), int64(saved.Len())); err != nil {
+				t.Fatal(err)
+			}
+			var again bytes.Buffer
+			if _, err := restored.Backup(alice.ID, &again); err != nil {
+				t.Fatal(err)
+			}
+
+			before, after := backupContents(t, saved.Bytes()), backupContents(t, again.Bytes())
+			for _, table := range backupTables {
+				name := table.name + ".jsonl"
+				if table.name == "audit_log" {
+					// восстановление тоже попадает в журнал
+					if len(after[name]) != len(before[name])+1 {
+						t.Errorf("%s: %d записей, ожидалось %d", name, len(after[name]), len(before[name])+1)
+					}
+					continue
+				}
+				if !slices.Equal(before[name], after[name]) {
+					t.Errorf("%s различается после восстановления:\n%s\n%s", name, before[name], after[name])
+				}
+			}
+
+			q, err := restored.Question(0, qid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Likes != 1 || q.Answers != 1 {
+				t.Errorf("счётчики восстановленного вопроса: %+v", q.QuestionSummary)
+			}
+			// последовательности продолжаются после восстановленных номеров
+			ask(t, restored, bob, "Новый вопрос после восстановления #backup")
+
+			if _, err := restored.Restore(alice.ID, bytes.NewReader(saved.Bytes()), int64(saved.Len())); err == nil {
+				t.Error("копия восстановлена в непустую базу")
+			}
+		})
+	}
+}
+
+func TestRestoreNewerSchema(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		var buf bytes.Buffer
+		archive := zip.NewWriter(&buf)
+		f, err := archive.Create(backupManifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(f).Encode(BackupManifest{Format: backupFormat, Version: backupVersion, SchemaVersion: database.SchemaVersion + 1})
+		archive.Close()
+
+		if _, err := b.Restore(1, bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil {
+			t.Error("восстановлена копия с более новой схемой")
+		}
+	})
+}
+
+// backupContents возвращает строки файлов копии.
+func backupContents(t *testing.T, data []byte) map[string][]string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]string)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range bytes.Split(bytes.TrimSpace(content), []byte("\n")) {
+			if len(line) > 0 {
+				files[f.Name] = append(files[f.Name], string(line))
+			}
+		}
+	}
+	return files
+}
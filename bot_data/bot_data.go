@@ -2,49 +2,51 @@ package bot_data
 
 import (
 	"QADots/database"
-	"bytes"
-	"encoding/csv"
-	"errors"
+	"database/sql"
 	"flag"
 	"fmt"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/lib/pq"
 	tgbotapi "github.com/skinass/telegram-bot-api/v5"
 )
 
-const (
-	tasksListPrint = `Команды для работы с ботом: 
-/start - зарегистрироваться
-/ask <вопрос>~<tags> - задать вопрос.
-/answer <номер вопроса>~<ответ> - ответить на вопрос. 
-/get_answers <номер вопроса> - получить все текущие ответы на вопрос 
-/questions <тег> - получить 10 самых залайканных вопросов по тегу 
-/my_questions - получить все заданные Вами вопросы
-/like_question <номер вопроса> - поставить лайк вопросу
-/like_answer <номер ответа> - поставить лайк ответу
-/help - показать все возможные команды`
-)
-
 var (
 	BotToken   = flag.String("tg.token", "", "token for telegram")
 	WebhookURL = flag.String("tg.webhook", "", "webhook addr for telegram")
+	Admins     = flag.String("tg.admins", "", "comma separated telegram user ids of bot administrators")
+	Moderators = flag.String("tg.moderators", "", "comma separated telegram user ids of moderators")
+
+	DigestInterval = flag.Duration("digest.interval", time.Hour, "how often to check for due digests")
 )
 
 type Bot struct {
 	API    *tgbotapi.BotAPI
 	dtbase *database.DB
+
+	// format размечает списки вопросов, ответов и дайджесты
+	format Formatter
+
+	mu      sync.Mutex
+	pending map[int64]pendingQuestion
+
+	cache caches
 }
 
 func (b *Bot) Init() error {
+	if err := b.InitStore(); err != nil {
+		return err
+	}
+
 	bot, err := tgbotapi.NewBotAPI(*BotToken)
 	if err != nil {
 		return err
 	}
 
-	b.dtbase = database.InitDB()
-
 	b.API = bot
 
 	b.API.Debug = true
@@ -66,6 +68,21 @@ func (b *Bot) Init() error {
 	return nil
 }
 
+// InitStore подключает бота к базе без Telegram. Так хранилище бота используют
+// утилиты вроде qadmin.
+func (b *Bot) InitStore() error {
+	format, ok := LookupFormatter(*ParseMode)
+	if !ok {
+		return fmt.Errorf("неизвестный режим разметки: %s", *ParseMode)
+	}
+	b.format = format
+
+	b.dtbase = database.InitDB()
+	b.pending = make(map[int64]pendingQuestion)
+	b.cache = newCaches(*CacheSize, *CacheTTL)
+	return nil
+}
+
 type Task struct {
 	ID      int64
 	Title   string
@@ -73,8 +90,8 @@ type Task struct {
 	ForWhom *tgbotapi.User
 }
 
-func (b *Bot) Help() string {
-	return tasksListPrint
+func (b *Bot) Help(u *tgbotapi.User) string {
+	return helpText(b.settings(u.ID).Locale)
 }
 
 func (b *Bot) Start(u *tgbotapi.User) string {
@@ -87,31 +104,45 @@ func (b *Bot) Start(u *tgbotapi.User) string {
 	`
 
 	userID := 0
-	b.dtbase.Db.QueryRow(query, u.ID, u.UserName, 0, 0, 1).Scan(&userID)
+	err := b.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow(query, u.ID, u.UserName, 0, 0, 1).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return audit(tx, u.ID, AuditRegister, auditTargetUser, u.ID, nil, map[string]interface{}{"username": u.UserName})
+	})
+	if err != nil {
+		log.Printf("Ошибка при регистрации пользователя: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
 
 	if userID == 0 {
-		return "Пользователь уже существует"
+		return b.T(u.ID, "user_exists")
 	}
 
 	fmt.Printf("Новый пользователь добавлен с ID %d\n", userID)
-	return "Успешная регистрация"
+	return b.T(u.ID, "registered")
 }
 
-func (b *Bot) linkTagQuestion(tag_id int, question int) {
+func linkTagQuestion(tx dbtx, tag_id int, question int) error {
 	query := `
 	INSERT INTO public.questiontags(
 	question_id, tag_id)
 	VALUES ($1, $2)
 	ON CONFLICT DO NOTHING;
 	`
-	_, err := b.dtbase.Db.Exec(query, question, tag_id)
+	_, err := tx.Exec(query, question, tag_id)
 	if err != nil {
-		log.Printf("Ошибка при линковке тега и question_id: %v", err)
+		return err
 	}
 	fmt.Printf("Линковка тега и question_id прошла успешно: %d \n", tag_id)
+	return nil
 }
 
-func (b *Bot) AddTags(tags []string, question_id int) {
+func (b *Bot) AddTags(tx dbtx, tags []string, question_id int) error {
 	query := `
 	INSERT INTO public.tags(tag_name)
 	VALUES ($1)
@@ -121,165 +152,240 @@ func (b *Bot) AddTags(tags []string, question_id int) {
 `
 
 	tag_id := 0
-	for _, tag := range tags {
-		err := b.dtbase.Db.QueryRow(query, tag).Scan(&tag_id)
+	for _, tag := range canonicalTagsIn(tx, tags) {
+		err := tx.QueryRow(query, tag).Scan(&tag_id)
 		if err != nil {
-			log.Printf("Ошибка при добавлении тега: %v", err)
+			return err
 		}
 		fmt.Printf("Новый тег добавлен: %s \n", tag)
-		b.linkTagQuestion(tag_id, question_id)
+		if err := linkTagQuestion(tx, tag_id, question_id); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 func (b *Bot) checkRegistration(userID int64) bool {
-	query := "SELECT CheckUserRegistration($1);"
+	if _, ok := b.cache.registered.Get(userID); ok {
+		return true
+	}
+	query := "SELECT EXISTS (SELECT 1 FROM public.users WHERE user_id = $1);"
 
 	var exist bool
 	_ = b.dtbase.Db.QueryRow(query, userID).Scan(&exist)
+	if exist {
+		b.cache.registered.Set(userID, true)
+	}
 	return exist
 }
 
-func (b *Bot) isQuestionExist(userID int64) bool {
-	query := "SELECT CheckQuestionExistence($1);"
+func (b *Bot) isQuestionExist(questionID int64) bool {
+	query := "SELECT EXISTS (SELECT 1 FROM public.questions WHERE question_id = $1 AND deleted_at IS NULL);"
 
 	var exist bool
-	_ = b.dtbase.Db.QueryRow(query, userID).Scan(&exist)
+	_ = b.dtbase.Db.QueryRow(query, questionID).Scan(&exist)
 	return exist
 }
 
-func (b *Bot) isAnswerExist(userID int64) bool {
-	query := "SELECT CheckAnswerExistence($1);"
+func (b *Bot) isAnswerExist(answerID int64) bool {
+	query := "SELECT EXISTS (SELECT 1 FROM public.answers WHERE answer_id = $1);"
 
 	var exist bool
-	_ = b.dtbase.Db.QueryRow(query, userID).Scan(&exist)
+	_ = b.dtbase.Db.QueryRow(query, answerID).Scan(&exist)
 	return exist
 }
 
-func parseArgs(args string) (string, []string, error) {
-	res := strings.Split(args, "~")
-	if len(res) != 2 {
-		return "", nil, errors.New("Неправильно переданы аргументы")
-	}
-	return res[0], strings.Split(res[1], " "), nil
-}
-
-func (b *Bot) Ask(u *tgbotapi.User, args string) string {
+func (b *Bot) Ask(u *tgbotapi.User, chat *tgbotapi.Chat, args string, attachments []Attachment) Reply {
 
 	exist := b.checkRegistration(u.ID)
 	if !exist {
-		return "Сначала зарегистрируйтесь с помощью команды /start"
+		return Text(b.T(u.ID, "not_registered"))
 	}
 
-	question, tags, err := parseArgs(args)
+	question, tags, err := parseQuestion(args)
 	if err != nil {
-		return err.Error()
+		return Text(b.ErrorText(u.ID, usageError("ask", err)))
+	}
+
+	communityID := b.scope(u.ID, chat)
+	duplicates := b.similarQuestions(communityID, question)
+	if len(duplicates) > 0 {
+		b.setPending(u.ID, pendingQuestion{text: question, tags: tags, attachments: attachments, communityID: communityID, created: time.Now()})
+		locale := b.settings(u.ID).Locale
+		return Reply{
+			Records: []string{duplicatesMessage(b.format, locale, duplicates)},
+			Markup:  duplicatesKeyboard(locale, duplicates),
+			Format:  b.format,
+		}
 	}
+
+	return Text(b.postQuestion(u, communityID, question, tags, attachments))
+}
+
+func (b *Bot) postQuestion(u *tgbotapi.User, communityID int64, question string, tags []string, attachments []Attachment) string {
 	query := `
 		INSERT INTO public.questions(
-		user_id, question_text, created_at, is_closed)
-		VALUES ($1, $2, $3, $4)
+		user_id, question_text, created_at, is_closed, community_id)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING question_id;
 	`
-	question_id := 0
-	err = b.dtbase.Db.QueryRow(query, u.ID, question, "NOW()", 0).Scan(&question_id)
+	community := communityArg(communityID)
+	err := b.inTx(func(tx *sql.Tx) error {
+		question_id := 0
+		err := tx.QueryRow(query, u.ID, question, time.Now(), false, community).Scan(&question_id)
+		if err != nil {
+			return err
+		}
+		if err := b.AddTags(tx, tags, question_id); err != nil {
+			return err
+		}
+		if err := saveAttachments(tx, "question_id", int64(question_id), attachments); err != nil {
+			return err
+		}
+		after := map[string]interface{}{"text": question, "tags": tags, "community_id": community, "attachments": len(attachments)}
+		if err := audit(tx, u.ID, AuditQuestionCreate, auditTargetQuestion, question_id, nil, after); err != nil {
+			return err
+		}
+		return b.emitQuestionCreated(tx, u, int64(question_id), question)
+	})
 	if err != nil {
 		log.Printf("Ошибка при добавлении вопроса, повторите ещё раз: %v", err)
+		return b.T(u.ID, "error_retry")
 	}
-
-	b.AddTags(tags, question_id)
+	b.invalidateTags(communityID, tags)
 
 	fmt.Printf("Новый вопрос\n")
-	return "Вопрос добавлен успешно. Ожидайте ответа от пользователей"
+	return b.T(u.ID, "question_added")
 }
 
-func (b *Bot) Questions(u *tgbotapi.User, arg string) string {
+// topQuestions возвращает самые залайканные открытые вопросы сообщества по тегу,
+// созданные не раньше since. Используется в /questions и в дайджестах.
+func (b *Bot) topQuestions(community int64, tag string, since time.Time, limit int) (*sql.Rows, error) {
 	query := `
-		SELECT u.username, q.question_text, q.created_at, q.question_id, COUNT(ql.like_id) AS like_count
+		SELECT u.user_id, u.username, q.question_text, q.created_at, q.question_id, q.like_count, ` + questionTags + `
 		FROM public.questions q
 		JOIN public.questiontags qt ON q.question_id = qt.question_id
 		JOIN public.tags t ON qt.tag_id = t.tag_id
 		JOIN public.users u ON q.user_id = u.user_id
-		LEFT JOIN public.questionlikes ql ON q.question_id = ql.question_id
-		WHERE t.tag_name = $1 AND q.is_closed = $2
-		GROUP BY u.username, q.question_text, q.created_at, q.question_id
-		ORDER BY like_count DESC
-		LIMIT 10;
+		WHERE t.tag_name = $1 AND q.is_closed = $2 AND q.created_at >= $3 AND q.deleted_at IS NULL AND ` + communityFilter("q.community_id", 5) + `
+		ORDER BY q.like_count DESC, q.question_id DESC
+		LIMIT $4;
 	`
-	rows, err := b.dtbase.Db.Query(query, arg, false)
-	if err != nil {
-		log.Printf("Ошибка при поиске вопросов по данному тегу: %v", err)
-	}
-	defer rows.Close()
+	return b.dtbase.Db.Query(query, tag, false, since, limit, communityArg(community))
+}
 
-	var csvData [][]string
-	csvData = append(csvData, []string{"Username", "Question Text", "Created At", "Question ID", "Like Count"})
+// questionTags - выражение SQL со всеми тегами вопроса q по алфавиту.
+const questionTags = `COALESCE((
+	SELECT array_agg(tt.tag_name ORDER BY tt.tag_name) FROM public.questiontags tqt
+	JOIN public.tags tt ON tt.tag_id = tqt.tag_id
+	WHERE tqt.question_id = q.question_id), '{}')`
+
+type questionRow struct {
+	UserID    int64
+	Username  string
+	Text      string
+	CreatedAt time.Time
+	ID        int64
+	Likes     int
+	Tags      []string
+}
 
-	count := 0
-	var result string
+// scanQuestions читает строки результата topQuestions.
+func scanQuestions(rows *sql.Rows) []questionRow {
+	var result []questionRow
 	for rows.Next() {
-		var question struct {
-			username      string
-			QuestionText  string
-			CreatedAt     string
-			questionNum   int64
-			questionLikes int
-		}
-
-		err := rows.Scan(&question.username, &question.QuestionText, &question.CreatedAt, &question.questionNum, &question.questionLikes)
-		result += "Вопрос от пользователя " + question.username +
-			" создан " + question.CreatedAt +
-			" номер вопроса " + strconv.FormatInt(question.questionNum, 10) +
-			"\n" + question.QuestionText + "\n" + "Количество лайков: " + strconv.Itoa(question.questionLikes) + "\n\n"
-
-		if err != nil {
+		var q questionRow
+		if err := rows.Scan(&q.UserID, &q.Username, &q.Text, &q.CreatedAt, &q.ID, &q.Likes, pq.Array(&q.Tags)); err != nil {
 			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
 		}
-		count++
-		csvData = append(csvData, []string{
-			question.username,
-			question.QuestionText,
-			question.CreatedAt,
-			strconv.FormatInt(question.questionNum, 10),
-			strconv.Itoa(question.questionLikes),
-		})
+		result = append(result, q)
 	}
+	return result
+}
 
-	var buffer bytes.Buffer
-	writer := csv.NewWriter(&buffer)
+func questionsReply(f Formatter, s Settings, title string, questions []questionRow) Reply {
+	r := Reply{Records: []string{boldLine(f, title)}, Format: f}
+	for _, q := range questions {
+		r.Records = append(r.Records, trf(f, s.Locale, "question_entry",
+			mention(f, q.UserID, q.Username), s.FormatTime(q.CreatedAt), q.ID, content(f, q.Text), q.Likes))
+	}
+	return r
+}
 
-	for _, record := range csvData {
-		if err := writer.Write(record); err != nil {
-			log.Printf("Ошибка при записи в CSV буфер: %v", err)
-		}
+func (b *Bot) questionsByTag(community int64, tag string) ([]questionRow, error) {
+	key := listingKey{community: community, tag: tag}
+	if questions, ok := b.cache.listings.Get(key); ok {
+		return questions, nil
 	}
-	writer.Flush()
+	rows, err := b.topQuestions(community, tag, time.Time{}, 10)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	questions := scanQuestions(rows)
+	b.cache.listings.Set(key, questions)
+	return questions, nil
+}
 
-	doc := tgbotapi.NewDocument(int64(u.ID), tgbotapi.FileBytes{
-		Name:  "questions.csv",
-		Bytes: buffer.Bytes(),
-	})
+func questionsTable(s Settings, tag string, questions []questionRow) Table {
+	t := Table{
+		Name:   "questions_" + tag,
+		Header: []string{"Username", "Question Text", "Created At", "Question ID", "Like Count", "Tags"},
+	}
+	for _, q := range questions {
+		t.Rows = append(t.Rows, []string{
+			q.Username,
+			q.Text,
+			q.CreatedAt.In(s.Location()).Format(time.RFC3339),
+			strconv.FormatInt(q.ID, 10),
+			strconv.Itoa(q.Likes),
+			strings.Join(q.Tags, " "),
+		})
+	}
+	return t
+}
 
-	if _, err := b.API.Send(doc); err != nil {
-		log.Printf("Ошибка при отправке файла: %v", err)
-		return "Ошибка при отправке файла."
+// exportFiles прикладывает к списку файл, если пользователь не отключил это в настройках.
+func exportFiles(s Settings, t Table) []ExportFile {
+	if !s.ExportAttachments {
+		return nil
 	}
+	return []ExportFile{{Format: s.ExportFormat, Table: t}}
+}
 
-	if count == 0 {
-		return "Не найдено ни одного вопроса по тегу"
-	} else {
-		return result
+func (b *Bot) Questions(u *tgbotapi.User, chat *tgbotapi.Chat, arg string) Reply {
+	s := b.settings(u.ID)
+	tag := b.canonicalTag(arg)
+	questions, err := b.questionsByTag(b.scope(u.ID, chat), tag)
+	if err != nil {
+		log.Printf("Ошибка при поиске вопросов по данному тегу: %v", err)
+		return Text(tr(s.Locale, "error_retry"))
 	}
+
+	files := exportFiles(s, questionsTable(s, tag, questions))
+	if len(questions) == 0 {
+		r := Text(tr(s.Locale, "no_questions_by_tag"))
+		r.Files = files
+		return r
+	}
+	r := questionsReply(b.format, s, tr(s.Locale, "questions_title", tag), questions)
+	r.Files = files
+	for _, q := range questions {
+		r.Attachments = append(r.Attachments, b.questionAttachments(s.Locale, q.ID)...)
+	}
+	return r
 }
 
 func (b *Bot) Like_Question(u *tgbotapi.User, arg string) string {
 	parseArg, _ := strconv.ParseInt(arg, 10, 64)
-	exist := b.isQuestionExist(parseArg)
+	exist := b.isQuestionVisible(u.ID, parseArg)
 	if !exist {
-		return "Такого вопроса не существует"
+		return b.T(u.ID, "question_not_found")
 	}
 	exist = b.checkRegistration(u.ID)
 	if !exist {
-		return "Сначала зарегистрируйтесь с помощью команды /start"
+		return b.T(u.ID, "not_registered")
 	}
 	query := `
 		INSERT INTO QuestionLikes (question_id, user_id)
@@ -299,213 +405,275 @@ func (b *Bot) Like_Question(u *tgbotapi.User, arg string) string {
 	`
 	q_id, err := strconv.ParseInt(arg, 10, 64)
 	if err != nil {
-		return "Ошибка в введении номера вопроса"
+		return b.T(u.ID, "bad_question_id")
 	}
 	exist_q_id := 0
-	b.dtbase.Db.QueryRow(query, q_id, u.ID).Scan(&exist_q_id)
+	err = b.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow(query, q_id, u.ID).Scan(&exist_q_id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := audit(tx, u.ID, AuditQuestionLike, auditTargetQuestion, q_id, nil, nil); err != nil {
+			return err
+		}
+		if err := b.notifyQuestionLike(tx, u, q_id); err != nil {
+			return err
+		}
+		community, err := questionCommunity(tx, q_id)
+		if err != nil {
+			return err
+		}
+		return b.emit(tx, community, EventLikeAdded, fmt.Sprintf("question:%d:%d", q_id, u.ID), likeData(u, "question", q_id))
+	})
+	if err != nil {
+		log.Printf("Ошибка при добавлении лайка: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
 	if exist_q_id == 0 {
-		return "Вы уже ставили лайк этому вопросу"
+		return b.T(u.ID, "question_liked")
 	}
-
-	return "Лайк добавлен успешно."
+	b.invalidateListings()
+	return b.T(u.ID, "like_added")
 }
 
-func (b *Bot) My_Questions(u *tgbotapi.User) string {
-	exist := b.checkRegistration(u.ID)
-	if !exist {
-		return "Сначала зарегистрируйтесь с помощью команды /start"
-	}
+// userQuestions возвращает вопросы пользователя в сообществе community.
+func (b *Bot) userQuestions(u *tgbotapi.User, community int64) ([]questionRow, error) {
 	query := `
-		SELECT q.question_id, q.question_text, q.created_at, COUNT(ql.like_id) AS like_count
+		SELECT q.question_id, q.question_text, q.created_at, q.like_count, ` + questionTags + `
 		FROM public.questions q
-		LEFT JOIN public.questionlikes ql ON q.question_id = ql.question_id
-		WHERE q.user_id = $1
-		GROUP BY q.question_id, q.question_text, q.created_at, q.is_closed;
+		WHERE q.user_id = $1 AND q.deleted_at IS NULL AND ` + communityFilter("q.community_id", 2) + `
+		ORDER BY q.created_at;
 	`
-	rows, err := b.dtbase.Db.Query(query, u.ID)
+	rows, err := b.dtbase.Db.Query(query, u.ID, communityArg(community))
 	if err != nil {
-		log.Printf("Ошибка при поиске ваших вопросов: %v", err)
+		return nil, err
 	}
 	defer rows.Close()
 
-	var csvData [][]string
-	csvData = append(csvData, []string{"QuestionText", "CreatedAt", "questionNum", "questionLikes"})
-	count := 0
-	var result string
+	var result []questionRow
 	for rows.Next() {
-		var question struct {
-			QuestionText  string
-			CreatedAt     string
-			questionNum   int64
-			questionLikes int
-		}
-
-		err := rows.Scan(&question.questionNum, &question.QuestionText, &question.CreatedAt, &question.questionLikes)
-		result += "Вопрос от пользователя " + u.UserName +
-			" создан " + question.CreatedAt +
-			" номер вопроса " + strconv.FormatInt(question.questionNum, 10) +
-			"\n" + question.QuestionText + "\n" + "Количество лайков: " + strconv.Itoa(question.questionLikes) + "\n\n"
-
-		if err != nil {
+		q := questionRow{UserID: u.ID, Username: u.UserName}
+		if err := rows.Scan(&q.ID, &q.Text, &q.CreatedAt, &q.Likes, pq.Array(&q.Tags)); err != nil {
 			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
 		}
-		count++
-		csvData = append(csvData, []string{
-			question.QuestionText,
-			question.CreatedAt,
-			strconv.FormatInt(question.questionNum, 10),
-			strconv.Itoa(question.questionLikes),
-		})
-
+		result = append(result, q)
 	}
+	return result, nil
+}
 
-	var buffer bytes.Buffer
-	writer := csv.NewWriter(&buffer)
-
-	for _, record := range csvData {
-		if err := writer.Write(record); err != nil {
-			log.Printf("Ошибка при записи в CSV буфер: %v", err)
-		}
+func myQuestionsTable(s Settings, questions []questionRow) Table {
+	t := Table{
+		Name:   "my_questions",
+		Header: []string{"Question ID", "Question Text", "Created At", "Like Count", "Username", "Tags"},
+	}
+	for _, q := range questions {
+		t.Rows = append(t.Rows, []string{
+			strconv.FormatInt(q.ID, 10),
+			q.Text,
+			q.CreatedAt.In(s.Location()).Format(time.RFC3339),
+			strconv.Itoa(q.Likes),
+			q.Username,
+			strings.Join(q.Tags, " "),
+		})
 	}
-	writer.Flush()
-
-	doc := tgbotapi.NewDocument(int64(u.ID), tgbotapi.FileBytes{
-		Name:  "questions.csv",
-		Bytes: buffer.Bytes(),
-	})
+	return t
+}
 
-	if _, err := b.API.Send(doc); err != nil {
-		log.Printf("Ошибка при отправке файла: %v", err)
-		return "Ошибка при отправке файла."
+func (b *Bot) My_Questions(u *tgbotapi.User, chat *tgbotapi.Chat) Reply {
+	s := b.settings(u.ID)
+	exist := b.checkRegistration(u.ID)
+	if !exist {
+		return Text(tr(s.Locale, "not_registered"))
+	}
+	questions, err := b.userQuestions(u, b.scope(u.ID, chat))
+	if err != nil {
+		log.Printf("Ошибка при поиске ваших вопросов: %v", err)
+		return Text(tr(s.Locale, "error_retry"))
 	}
 
-	if count == 0 {
-		return "Не найдено ни одного вопроса"
-	} else {
-		return result
+	files := exportFiles(s, myQuestionsTable(s, questions))
+	if len(questions) == 0 {
+		r := Text(tr(s.Locale, "no_questions"))
+		r.Files = files
+		return r
+	}
+	r := questionsReply(b.format, s, tr(s.Locale, "my_questions_title"), questions)
+	r.Files = files
+	for _, q := range questions {
+		r.Attachments = append(r.Attachments, b.questionAttachments(s.Locale, q.ID)...)
 	}
+	return r
 }
 
-func (b *Bot) Answer(u *tgbotapi.User, args []string) string {
+func (b *Bot) Answer(u *tgbotapi.User, args []string, attachments []Attachment) string {
 	parseArg, _ := strconv.ParseInt(args[0], 10, 64)
-	exist := b.isQuestionExist(parseArg)
+	exist := b.isQuestionVisible(u.ID, parseArg)
 	if !exist {
-		return "Такого вопроса не существует"
+		return b.T(u.ID, "question_not_found")
 	}
 	exist = b.checkRegistration(u.ID)
 	if !exist {
-		return "Сначала зарегистрируйтесь с помощью команды /start"
+		return b.T(u.ID, "not_registered")
 	}
 	query := `
 		INSERT INTO Answers (question_id, user_id, answer_text)
 		VALUES ($1, $2, $3)
-		ON CONFLICT DO NOTHING;
+		ON CONFLICT DO NOTHING
+		RETURNING answer_id;
 	`
-	_, err := b.dtbase.Db.Query(query, args[0], u.ID, args[1])
+	err := b.inTx(func(tx *sql.Tx) error {
+		var answerID int64
+		err := tx.QueryRow(query, args[0], u.ID, args[1]).Scan(&answerID)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := saveAttachments(tx, "answer_id", answerID, attachments); err != nil {
+			return err
+		}
+		after := map[string]interface{}{"question_id": parseArg, "text": args[1], "attachments": len(attachments)}
+		if err := audit(tx, u.ID, AuditAnswerCreate, auditTargetAnswer, answerID, nil, after); err != nil {
+			return err
+		}
+		if err := b.notifyAnswer(tx, u, parseArg, answerID, args[1]); err != nil {
+			return err
+		}
+		community, err := questionCommunity(tx, parseArg)
+		if err != nil {
+			return err
+		}
+		return b.emit(tx, community, EventAnswerCreated, fmt.Sprintf("answer:%d", answerID), answerEvent{
+			AnswerID:   answerID,
+			QuestionID: parseArg,
+			UserID:     u.ID,
+			Username:   u.UserName,
+			Text:       args[1],
+		})
+	})
 	if err != nil {
 		log.Printf("Ошибка при добавлении ответа, повторите ещё раз: %v", err)
+		return b.T(u.ID, "error_retry")
 	}
+	b.invalidateAnswers(parseArg)
+	return b.T(u.ID, "answer_added")
+}
 
-	return "Ответ добавлен успешно. Ожидайте лайков)"
+type answerRow struct {
+	ID        int64
+	Text      string
+	UserID    int64
+	Username  string
+	Status    string
+	CreatedAt time.Time
+	Likes     int
 }
 
-func (b *Bot) Get_Answers(u *tgbotapi.User, arg string) string {
-	parseArg, _ := strconv.ParseInt(arg, 10, 64)
-	exist := b.isQuestionExist(parseArg)
-	if !exist {
-		return "Такого вопроса не существует"
+func (b *Bot) questionAnswers(questionID int64) ([]answerRow, error) {
+	if answers, ok := b.cache.answers.Get(questionID); ok {
+		return answers, nil
 	}
 	query := `
-		SELECT a.answer_id, a.answer_text, u.username, s.status_name, a.created_at AS answer_time, COUNT(al.like_id) AS like_count
+		SELECT a.answer_id, a.answer_text, u.user_id, u.username, s.status_name, a.created_at AS answer_time, a.like_count
 		FROM Answers a
 		JOIN Users u ON a.user_id = u.user_id
 		JOIN Statuses s ON u.status_id = s.status_id
-		LEFT JOIN AnswerLikes al ON a.answer_id = al.answer_id
 		WHERE a.question_id = $1
-		GROUP BY a.answer_id, a.answer_text, u.username, s.status_name, a.created_at;
+		ORDER BY a.created_at;
 	`
-	q_id, err := strconv.ParseInt(arg, 10, 64)
+	rows, err := b.dtbase.Db.Query(query, questionID)
 	if err != nil {
-		return "Ошибка в введении номера вопроса"
-	}
-	rows, err1 := b.dtbase.Db.Query(query, q_id)
-	if err1 != nil {
-		return "Ошибка. Попробуйте еще раз."
+		return nil, err
 	}
 	defer rows.Close()
 
-	var csvData [][]string
-	csvData = append(csvData, []string{"answerID", "answerText", "username", "statusName", "created", "likeCount"})
-
-	count := 0
-	var result string
+	var result []answerRow
 	for rows.Next() {
-		var answer struct {
-			answerID   int64
-			answerText string
-			username   string
-			statusName string
-			created    string
-			likeCount  int
-		}
-
-		err := rows.Scan(&answer.answerID, &answer.answerText, &answer.username, &answer.statusName, &answer.created, &answer.likeCount)
-		result += "Ответ от пользователя " + answer.username +
-			" создан " + answer.created +
-			" номер ответа " + strconv.FormatInt(answer.answerID, 10) +
-			"\n" + answer.answerText + "\n" + "Количество лайков: " + strconv.Itoa(answer.likeCount) + "\n" +
-			"Статус пользователя: " + answer.statusName + "\n\n"
-
-		if err != nil {
+		var a answerRow
+		if err := rows.Scan(&a.ID, &a.Text, &a.UserID, &a.Username, &a.Status, &a.CreatedAt, &a.Likes); err != nil {
 			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
 		}
-		count++
-		csvData = append(csvData, []string{
-			strconv.FormatInt(answer.answerID, 10),
-			answer.answerText,
-			answer.username,
-			answer.statusName,
-			answer.created,
-			strconv.Itoa(answer.likeCount),
-		})
+		result = append(result, a)
 	}
+	b.cache.answers.Set(questionID, result)
+	return result, nil
+}
 
-	var buffer bytes.Buffer
-	writer := csv.NewWriter(&buffer)
-
-	for _, record := range csvData {
-		if err := writer.Write(record); err != nil {
-			log.Printf("Ошибка при записи в CSV буфер: %v", err)
-		}
+func answersReply(f Formatter, s Settings, title string, answers []answerRow) Reply {
+	r := Reply{Records: []string{boldLine(f, title)}, Format: f}
+	for _, a := range answers {
+		r.Records = append(r.Records, trf(f, s.Locale, "answer_entry",
+			mention(f, a.UserID, a.Username), s.FormatTime(a.CreatedAt), a.ID, content(f, a.Text), a.Likes, a.Status))
 	}
-	writer.Flush()
+	return r
+}
 
-	doc := tgbotapi.NewDocument(int64(u.ID), tgbotapi.FileBytes{
-		Name:  "questions.csv",
-		Bytes: buffer.Bytes(),
-	})
+func answersTable(s Settings, questionID int64, answers []answerRow) Table {
+	t := Table{
+		Name:   "answers_" + strconv.FormatInt(questionID, 10),
+		Header: []string{"Answer ID", "Answer Text", "Username", "Status", "Created At", "Like Count"},
+	}
+	for _, a := range answers {
+		t.Rows = append(t.Rows, []string{
+			strconv.FormatInt(a.ID, 10),
+			a.Text,
+			a.Username,
+			a.Status,
+			a.CreatedAt.In(s.Location()).Format(time.RFC3339),
+			strconv.Itoa(a.Likes),
+		})
+	}
+	return t
+}
 
-	if _, err := b.API.Send(doc); err != nil {
-		log.Printf("Ошибка при отправке файла: %v", err)
-		return "Ошибка при отправке файла."
+func (b *Bot) Get_Answers(u *tgbotapi.User, arg string) Reply {
+	s := b.settings(u.ID)
+	q_id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return Text(tr(s.Locale, "bad_question_id"))
+	}
+	exist := b.isQuestionVisible(u.ID, q_id)
+	if !exist {
+		return Text(tr(s.Locale, "question_not_found"))
+	}
+	answers, err := b.questionAnswers(q_id)
+	if err != nil {
+		log.Printf("Ошибка при поиске ответов: %v", err)
+		return Text(tr(s.Locale, "error_retry"))
 	}
 
-	if count == 0 {
-		return "Не найдено ни одного вопроса"
-	} else {
-		return result
+	files := exportFiles(s, answersTable(s, q_id, answers))
+	attachments := b.questionAttachments(s.Locale, q_id)
+	if len(answers) == 0 {
+		r := Text(tr(s.Locale, "no_answers"))
+		r.Files = files
+		r.Attachments = attachments
+		return r
 	}
+	r := answersReply(b.format, s, tr(s.Locale, "answers_title", q_id), answers)
+	r.Files = files
+	r.Attachments = attachments
+	for _, a := range answers {
+		r.Attachments = append(r.Attachments, b.answerAttachments(s.Locale, a.ID)...)
+	}
+	return r
 }
 
 func (b *Bot) Like_Answer(u *tgbotapi.User, arg string) string {
 	parseArg, _ := strconv.ParseInt(arg, 10, 64)
-	exist := b.isAnswerExist(parseArg)
+	exist := b.isAnswerVisible(u.ID, parseArg)
 	if !exist {
-		return "Такого ответа не существует"
+		return b.T(u.ID, "answer_not_found")
 	}
 	exist = b.checkRegistration(u.ID)
 	if !exist {
-		return "Сначала зарегистрируйтесь с помощью команды /start"
+		return b.T(u.ID, "not_registered")
 	}
 	query := `
 		INSERT INTO AnswerLikes (answer_id, user_id)
@@ -525,14 +693,86 @@ func (b *Bot) Like_Answer(u *tgbotapi.User, arg string) string {
 	`
 	a_id, err := strconv.ParseInt(arg, 10, 64)
 	if err != nil {
-		return "Ошибка в введении номера ответа"
+		return b.T(u.ID, "bad_answer_id")
 	}
 
 	exist_a_id := 0
-	b.dtbase.Db.QueryRow(query, a_id, u.ID).Scan(&exist_a_id)
+	var questionID int64
+	err = b.inTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow(query, a_id, u.ID).Scan(&exist_a_id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.QueryRow("SELECT question_id FROM public.answers WHERE answer_id = $1;", a_id).Scan(&questionID); err != nil {
+			return err
+		}
+		if err := audit(tx, u.ID, AuditAnswerLike, auditTargetAnswer, a_id, nil, nil); err != nil {
+			return err
+		}
+		if err := b.notifyAnswerLike(tx, u, a_id); err != nil {
+			return err
+		}
+		community, err := questionCommunity(tx, questionID)
+		if err != nil {
+			return err
+		}
+		return b.emit(tx, community, EventLikeAdded, fmt.Sprintf("answer:%d:%d", a_id, u.ID), likeData(u, "answer", a_id))
+	})
+	if err != nil {
+		log.Printf("Ошибка при добавлении лайка: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
 	if exist_a_id == 0 {
-		return "Вы уже ставили лайк этому ответу"
+		return b.T(u.ID, "answer_liked")
 	}
+	b.invalidateAnswers(questionID)
+	return b.T(u.ID, "like_added")
+}
 
-	return "Лайк добавлен успешно."
+// Close закрывает вопрос. Закрыть вопрос может его автор или модератор.
+func (b *Bot) Close(u *tgbotapi.User, arg string) string {
+	questionID, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return b.T(u.ID, "bad_question_id")
+	}
+	if !b.isQuestionVisible(u.ID, questionID) {
+		return b.T(u.ID, "question_not_found")
+	}
+	if questionOwner(b.dtbase.Db, questionID) != u.ID && !isModerator(u.ID) {
+		return b.T(u.ID, "close_not_owner")
+	}
+	closed := false
+	err = b.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE public.questions SET is_closed = true WHERE question_id = $1 AND is_closed = false;", questionID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		closed = true
+		err = audit(tx, u.ID, AuditQuestionClose, auditTargetQuestion, questionID,
+			map[string]bool{"closed": false}, map[string]bool{"closed": true})
+		if err != nil {
+			return err
+		}
+		community, err := questionCommunity(tx, questionID)
+		if err != nil {
+			return err
+		}
+		return b.emit(tx, community, EventQuestionClosed, fmt.Sprintf("question:%d", questionID),
+			questionEvent{QuestionID: questionID, UserID: u.ID, Username: u.UserName})
+	})
+	if err != nil {
+		log.Printf("Ошибка при закрытии вопроса: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	if !closed {
+		return b.T(u.ID, "question_already_closed")
+	}
+	b.invalidateListings()
+	return b.T(u.ID, "question_closed", questionID)
 }
@@ -0,0 +1,67 @@
+package bot_data
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		u := testUser(1, "alice")
+		expect(t, b.Ask(u, nil, "Как работает defer? #go", nil).Records[0], "not_registered")
+		expect(t, b.Start(u), "registered")
+		expect(t, b.Start(u), "user_exists")
+		if !b.checkRegistration(u.ID) {
+			t.Fatal("пользователь не зарегистрирован")
+		}
+	})
+}
+
+func TestAskAnswerLike(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice, bob := testUser(1, "alice"), testUser(2, "bob")
+		b.Start(alice)
+		b.Start(bob)
+
+		qid := ask(t, b, alice, "Как работает defer? #go ~ Runtime")
+		aid := answer(t, b, bob, qid, "Откладывает вызов до выхода из функции")
+
+		q, err := b.Question(0, qid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"go", "runtime"}; !slices.Equal(q.Tags, want) {
+			t.Errorf("теги %v, ожидались %v", q.Tags, want)
+		}
+		if q.Answers != 1 || len(q.AnswerList) != 1 || q.AnswerList[0].ID != aid {
+			t.Errorf("ответы вопроса: %d, %+v", q.Answers, q.AnswerList)
+		}
+
+		expect(t, b.Like_Question(bob, strconv.FormatInt(qid, 10)), "like_added")
+		expect(t, b.Like_Question(bob, strconv.FormatInt(qid, 10)), "question_liked")
+		expect(t, b.Like_Answer(alice, strconv.FormatInt(aid, 10)), "like_added")
+		expect(t, b.Like_Answer(alice, strconv.FormatInt(aid, 10)), "answer_liked")
+		expect(t, b.Like_Question(bob, "100"), "question_not_found")
+
+		q, err = b.Question(0, qid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Likes != 1 || q.AnswerList[0].Likes != 1 {
+			t.Errorf("лайки вопроса %d и ответа %d, ожидалось по одному", q.Likes, q.AnswerList[0].Likes)
+		}
+
+		// уведомление автору вопроса об ответе ставится в outbox
+		var n int
+		if err := b.dtbase.Db.QueryRow("SELECT COUNT(*) FROM public.outbox WHERE kind = $1;", outboxMessage).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("записей outbox %d, ожидалась 1", n)
+		}
+
+		expect(t, b.Close(bob, strconv.FormatInt(qid, 10)), "close_not_owner")
+		expect(t, b.Close(alice, strconv.FormatInt(qid, 10)), "question_closed", qid)
+	})
+}
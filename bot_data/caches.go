@@ -0,0 +1,60 @@
+package bot_data
+
+import (
+	"QADots/cache"
+	"flag"
+	"time"
+)
+
+var (
+	CacheSize = flag.Int("cache.size", 1000, "entries per in-process cache, 0 disables caching")
+	CacheTTL  = flag.Duration("cache.ttl", 30*time.Second, "how long cached listings, settings and registration checks stay valid")
+)
+
+// listingKey - вопросы по тегу в сообществе
+type listingKey struct {
+	community int64
+	tag       string
+}
+
+// caches - кэши выборок, которые выполняются почти на каждую команду.
+// Изменения, сделанные этим экземпляром бота, сбрасывают их сразу, а изменения
+// других экземпляров становятся видны не позже чем через CacheTTL.
+type caches struct {
+	// registered хранит только зарегистрированных пользователей
+	registered cache.Cache[int64, bool]
+	listings   cache.Cache[listingKey, []questionRow]
+	// answers - ответы на вопрос по его номеру
+	answers cache.Cache[int64, []answerRow]
+	// banned - заблокирован ли пользователь
+	banned cache.Cache[int64, bool]
+	// settings - настройки пользователя, они нужны для текста почти любого ответа
+	settings cache.Cache[int64, Settings]
+}
+
+func newCaches(size int, ttl time.Duration) caches {
+	return caches{
+		registered: cache.New[int64, bool](size, ttl),
+		listings:   cache.New[listingKey, []questionRow](size, ttl),
+		answers:    cache.New[int64, []answerRow](size, ttl),
+		banned:     cache.New[int64, bool](size, ttl),
+		settings:   cache.New[int64, Settings](size, ttl),
+	}
+}
+
+// invalidateTags сбрасывает списки вопросов сообщества по тегам tags.
+func (b *Bot) invalidateTags(community int64, tags []string) {
+	for _, tag := range b.canonicalTags(tags) {
+		b.cache.listings.Delete(listingKey{community: community, tag: tag})
+	}
+}
+
+// invalidateListings сбрасывает все списки вопросов: лайк или закрытие вопроса
+// меняют порядок и состав списков всех его тегов.
+func (b *Bot) invalidateListings() {
+	b.cache.listings.Purge()
+}
+
+func (b *Bot) invalidateAnswers(questionID int64) {
+	b.cache.answers.Delete(questionID)
+}
@@ -0,0 +1,104 @@
+package bot_data
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// Куда отправлять ответы на команды из группы
+const (
+	replyModeGroup   = "group"
+	replyModePrivate = "private"
+)
+
+// IsGroup сообщает, что чат - группа или супергруппа.
+func IsGroup(c *tgbotapi.Chat) bool {
+	return c != nil && (c.IsGroup() || c.IsSuperGroup())
+}
+
+// AddressedToMe проверяет, что команда адресована этому боту. В группах команды
+// приходят как /ask@BotName, и имя после @ должно совпадать с именем бота.
+func (b *Bot) AddressedToMe(m *tgbotapi.Message) bool {
+	if !m.IsCommand() {
+		return false
+	}
+	_, name, ok := strings.Cut(m.CommandWithAt(), "@")
+	return !ok || strings.EqualFold(name, b.API.Self.UserName)
+}
+
+func (b *Bot) chatReplyMode(chatID int64) string {
+	mode := replyModeGroup
+	err := b.dtbase.Db.QueryRow("SELECT reply_mode FROM public.chatsettings WHERE chat_id = $1;", chatID).Scan(&mode)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Ошибка при чтении настроек чата: %v", err)
+	}
+	return mode
+}
+
+func setChatReplyMode(q dbtx, chatID int64, mode string) error {
+	query := `
+		INSERT INTO public.chatsettings (chat_id, reply_mode)
+		VALUES ($1, $2)
+		ON CONFLICT (chat_id) DO UPDATE SET reply_mode = EXCLUDED.reply_mode;
+	`
+	_, err := q.Exec(query, chatID, mode)
+	return err
+}
+
+// ReplyChat выбирает, куда отправить ответ на сообщение: в сам чат
+// или, если так настроено в группе, автору в личные сообщения.
+func (b *Bot) ReplyChat(m *tgbotapi.Message) int64 {
+	if IsGroup(m.Chat) && b.chatReplyMode(m.Chat.ID) == replyModePrivate {
+		return m.From.ID
+	}
+	return m.Chat.ID
+}
+
+// isChatAdmin - администратор группы в Telegram или администратор бота.
+func (b *Bot) isChatAdmin(chatID, userID int64) bool {
+	if isAdmin(userID) {
+		return true
+	}
+	member, err := b.API.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID},
+	})
+	if err != nil {
+		log.Printf("Ошибка при получении участника чата: %v", err)
+		return false
+	}
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+// Chat_Mode показывает или меняет, куда отправляются ответы на команды в группе.
+// Менять режим могут администраторы группы.
+func (b *Bot) Chat_Mode(u *tgbotapi.User, chat *tgbotapi.Chat, args []string) string {
+	if !IsGroup(chat) {
+		return b.T(u.ID, "chat_mode_group_only")
+	}
+	if len(args) == 0 {
+		return b.T(u.ID, "chat_mode_current", b.chatReplyMode(chat.ID))
+	}
+	mode := strings.ToLower(args[0])
+	if mode != replyModeGroup && mode != replyModePrivate {
+		return b.T(u.ID, "chat_mode_bad")
+	}
+	if !b.isChatAdmin(chat.ID, u.ID) {
+		return b.T(u.ID, "chat_admins_only")
+	}
+	before := b.chatReplyMode(chat.ID)
+	err := b.inTx(func(tx *sql.Tx) error {
+		if err := setChatReplyMode(tx, chat.ID, mode); err != nil {
+			return err
+		}
+		return audit(tx, u.ID, AuditChatMode, auditTargetChat, chat.ID,
+			map[string]string{"reply_mode": before}, map[string]string{"reply_mode": mode})
+	})
+	if err != nil {
+		log.Printf("Ошибка при сохранении настроек чата: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	return b.T(u.ID, "chat_mode_set", mode)
+}
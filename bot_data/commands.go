@@ -0,0 +1,243 @@
+package bot_data
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Виды аргументов команды.
+const (
+	// argsNone - команда без аргументов, всё после неё игнорируется
+	argsNone = iota
+	// argsWords - аргументы через пробелы, поддерживаются кавычки
+	argsWords
+	// argsTilde - два аргумента: до первой '~' (или первого пробела) и весь остальной текст
+	argsTilde
+	// argsRaw - текст передаётся как есть, разбор делает сама команда
+	argsRaw
+)
+
+// CommandSpec описывает синтаксис команды. Текст подсказки берётся из каталога
+// сообщений по ключам usage.<имя> и desc.<имя>.
+type CommandSpec struct {
+	Name    string
+	kind    int
+	minArgs int
+	maxArgs int
+	// numeric - номера аргументов, которые должны быть целыми числами
+	numeric []int
+}
+
+var commands = []CommandSpec{
+	{Name: "start", kind: argsNone},
+	{Name: "ask", kind: argsRaw},
+	{Name: "answer", kind: argsTilde, minArgs: 2, numeric: []int{0}},
+	{Name: "get_answers", kind: argsWords, minArgs: 1, maxArgs: 1, numeric: []int{0}},
+	{Name: "questions", kind: argsWords, minArgs: 1, maxArgs: 1},
+	{Name: "my_questions", kind: argsNone},
+	{Name: "like_question", kind: argsWords, minArgs: 1, maxArgs: 1, numeric: []int{0}},
+	{Name: "like_answer", kind: argsWords, minArgs: 1, maxArgs: 1, numeric: []int{0}},
+	{Name: "close", kind: argsWords, minArgs: 1, maxArgs: 1, numeric: []int{0}},
+	{Name: "export", kind: argsWords, minArgs: 2, maxArgs: 3},
+	{Name: "subscribe", kind: argsWords, minArgs: 1, maxArgs: 1},
+	{Name: "unsubscribe", kind: argsWords, minArgs: 1, maxArgs: 1},
+	{Name: "digest", kind: argsWords, minArgs: 1, maxArgs: 1},
+	{Name: "settings", kind: argsWords, maxArgs: 2},
+	{Name: "chat_mode", kind: argsWords, maxArgs: 1},
+	{Name: "community", kind: argsNone},
+	{Name: "community_create", kind: argsRaw},
+	{Name: "community_join", kind: argsWords, minArgs: 1, maxArgs: 1},
+	{Name: "community_switch", kind: argsWords, minArgs: 1, maxArgs: 1, numeric: []int{0}},
+	{Name: "community_leave", kind: argsWords, minArgs: 1, maxArgs: 1, numeric: []int{0}},
+	{Name: "tags", kind: argsWords, maxArgs: 2},
+	{Name: "tag", kind: argsWords, minArgs: 1, maxArgs: 1},
+	{Name: "tag_description", kind: argsTilde, minArgs: 2},
+	{Name: "merge_tags", kind: argsWords, minArgs: 2, maxArgs: 2},
+	{Name: "tag_synonym", kind: argsWords, minArgs: 2, maxArgs: 2},
+	{Name: "webhooks", kind: argsNone},
+	{Name: "webhook_add", kind: argsWords, minArgs: 1, maxArgs: 5},
+	{Name: "webhook_remove", kind: argsWords, minArgs: 1, maxArgs: 1, numeric: []int{0}},
+	{Name: "audit", kind: argsWords, maxArgs: 1},
+	{Name: "recount", kind: argsNone},
+	{Name: "help", kind: argsNone},
+}
+
+// LookupCommand возвращает описание команды по её имени.
+func LookupCommand(name string) (CommandSpec, bool) {
+	for _, c := range commands {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return CommandSpec{}, false
+}
+
+// UsageError - ошибка в аргументах команды вместе с подсказкой по её использованию.
+type UsageError struct {
+	Command string
+	Reason  error
+}
+
+func usageError(command string, reason error) UsageError {
+	return UsageError{Command: command, Reason: reason}
+}
+
+func (e UsageError) Error() string {
+	return e.Localize(defaultLocale)
+}
+
+func (e UsageError) Localize(locale string) string {
+	reason := e.Reason.Error()
+	if l, ok := e.Reason.(localizer); ok {
+		reason = l.Localize(locale)
+	}
+	return tr(locale, "usage", reason, tr(locale, "usage."+e.Command), tr(locale, "desc."+e.Command))
+}
+
+// Parse разбирает аргументы команды и проверяет их количество и формат.
+// Текст ошибки содержит подсказку по использованию команды.
+func (c CommandSpec) Parse(raw string) ([]string, error) {
+	var args []string
+	switch c.kind {
+	case argsNone:
+		return nil, nil
+
+	case argsRaw:
+		if strings.TrimSpace(raw) == "" {
+			return nil, usageError(c.Name, newError("args_missing"))
+		}
+		return []string{raw}, nil
+
+	case argsTilde:
+		head, tail := splitFirst(raw)
+		if head != "" {
+			args = append(args, head)
+		}
+		if tail != "" {
+			args = append(args, tail)
+		}
+
+	case argsWords:
+		var err error
+		args, err = Tokenize(raw)
+		if err != nil {
+			return nil, usageError(c.Name, err)
+		}
+	}
+
+	if len(args) < c.minArgs {
+		return nil, usageError(c.Name, newError("args_not_enough"))
+	}
+	if c.maxArgs > 0 && len(args) > c.maxArgs {
+		return nil, usageError(c.Name, newError("args_too_many"))
+	}
+	for _, i := range c.numeric {
+		if i < len(args) {
+			if _, err := strconv.ParseInt(args[i], 10, 64); err != nil {
+				return nil, usageError(c.Name, newError("args_not_number", args[i]))
+			}
+		}
+	}
+	return args, nil
+}
+
+// splitFirst делит строку по первой '~', а если её нет - по первому пробельному символу.
+// Вторая часть сохраняет переводы строк и все последующие '~'.
+func splitFirst(raw string) (string, string) {
+	raw = strings.TrimSpace(raw)
+	if i := strings.Index(raw, "~"); i >= 0 {
+		return strings.TrimSpace(raw[:i]), strings.TrimSpace(raw[i+1:])
+	}
+	if i := strings.IndexFunc(raw, unicode.IsSpace); i >= 0 {
+		return raw[:i], strings.TrimSpace(raw[i:])
+	}
+	return raw, ""
+}
+
+// Tokenize разбивает строку на слова по пробельным символам (включая переводы строк).
+// Фрагменты в двойных или одинарных кавычках считаются одним словом,
+// внутри кавычек обратный слэш экранирует следующий символ. Кавычка открывает
+// фрагмент только в начале слова, поэтому апостроф в don't остаётся частью слова.
+func Tokenize(s string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	var quote rune
+	inToken, escaped := false, false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote != 0 && r == '\\':
+			escaped = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case !inToken && (r == '"' || r == '\''):
+			quote = r
+			inToken = true
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, newError("quote_not_closed")
+	}
+	if inToken {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, nil
+}
+
+var hashtagRe = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_+\-.]+)`)
+
+// parseQuestion разбирает аргументы /ask: текст вопроса до первой '~' и теги после неё.
+// Хэштеги из текста вопроса тоже считаются тегами.
+func parseQuestion(raw string) (string, []string, error) {
+	question, tagsPart := raw, ""
+	if i := strings.Index(raw, "~"); i >= 0 {
+		question, tagsPart = raw[:i], raw[i+1:]
+	}
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return "", nil, newError("question_empty")
+	}
+
+	tags, err := Tokenize(tagsPart)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, m := range hashtagRe.FindAllStringSubmatch(question, -1) {
+		// точка и дефис в конце - знаки препинания после хэштега: "пишу на #go."
+		if tag := strings.TrimRight(m[1], ".-"); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return "", nil, newError("tags_required")
+	}
+	if err := checkTags(tags...); err != nil {
+		return "", nil, err
+	}
+	return question, tags, nil
+}
+
+func helpText(locale string) string {
+	var sb strings.Builder
+	sb.WriteString(tr(locale, "help_header") + "\n")
+	for _, c := range commands {
+		sb.WriteString(tr(locale, "usage."+c.Name) + " - " + tr(locale, "desc."+c.Name) + "\n")
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
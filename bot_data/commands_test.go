@@ -0,0 +1,139 @@
+package bot_data
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// errorKey возвращает ключ сообщения об ошибке, в том числе из UsageError.
+func errorKey(err error) string {
+	if u, ok := err.(UsageError); ok {
+		err = u.Reason
+	}
+	if e, ok := err.(i18nError); ok {
+		return e.key
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  string
+	}{
+		{in: "", want: nil},
+		{in: "  go  sql ", want: []string{"go", "sql"}},
+		{in: "a\nb\tc", want: []string{"a", "b", "c"}},
+		{in: `"новый тег" go`, want: []string{"новый тег", "go"}},
+		{in: `'a b' c`, want: []string{"a b", "c"}},
+		{in: `""`, want: []string{""}},
+		{in: `"say \"hi\"" 'it\'s'`, want: []string{`say "hi"`, "it's"}},
+		{in: `"a\\b"`, want: []string{`a\b`}},
+		{in: `back\slash`, want: []string{`back\slash`}},
+		// кавычка внутри слова - обычный символ
+		{in: "don't stop", want: []string{"don't", "stop"}},
+		{in: "rock'n'roll", want: []string{"rock'n'roll"}},
+		{in: `it's "x y"`, want: []string{"it's", "x y"}},
+		{in: `x"y z"`, want: []string{`x"y`, `z"`}},
+		// после закрывающей кавычки слово продолжается
+		{in: `"a b"c d`, want: []string{"a bc", "d"}},
+		{in: `"open`, err: "quote_not_closed"},
+		{in: `go 'open`, err: "quote_not_closed"},
+	}
+	for _, tt := range tests {
+		got, err := Tokenize(tt.in)
+		if key := errorKey(err); key != tt.err {
+			t.Errorf("Tokenize(%q): ошибка %q, ожидалась %q", tt.in, key, tt.err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, ожидалось %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		command string
+		in      string
+		want    []string
+		err     string
+	}{
+		{command: "start", in: "лишнее", want: nil},
+		{command: "ask", in: "  ", err: "args_missing"},
+		{command: "ask", in: " Как? ~ go ", want: []string{" Как? ~ go "}},
+		{command: "answer", in: "12 Ответ в несколько слов", want: []string{"12", "Ответ в несколько слов"}},
+		{command: "answer", in: "12 ~ ответ ~ с тильдой\nи переводом строки", want: []string{"12", "ответ ~ с тильдой\nи переводом строки"}},
+		{command: "answer", in: "12", err: "args_not_enough"},
+		{command: "answer", in: "двенадцать ответ", err: "args_not_number"},
+		{command: "like_question", in: "7", want: []string{"7"}},
+		{command: "like_question", in: "", err: "args_not_enough"},
+		{command: "like_question", in: "1 2", err: "args_too_many"},
+		{command: "like_question", in: "x", err: "args_not_number"},
+		{command: "merge_tags", in: `"old tag" new`, want: []string{"old tag", "new"}},
+		{command: "merge_tags", in: `"old tag new`, err: "quote_not_closed"},
+		{command: "settings", in: "", want: nil},
+	}
+	for _, tt := range tests {
+		spec, ok := LookupCommand(tt.command)
+		if !ok {
+			t.Fatalf("нет команды %s", tt.command)
+		}
+		got, err := spec.Parse(tt.in)
+		if key := errorKey(err); key != tt.err {
+			t.Errorf("%s %q: ошибка %q, ожидалась %q", tt.command, tt.in, key, tt.err)
+			continue
+		}
+		if err != nil {
+			if u, ok := err.(UsageError); !ok || u.Command != tt.command {
+				t.Errorf("%s %q: ошибка без подсказки по команде: %v", tt.command, tt.in, err)
+			}
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s %q = %q, ожидалось %q", tt.command, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuestion(t *testing.T) {
+	tests := []struct {
+		in       string
+		question string
+		tags     []string
+		err      string
+	}{
+		{in: "Как работает defer? ~ go runtime", question: "Как работает defer?", tags: []string{"go", "runtime"}},
+		{in: "Вопрос ~ \"big data\"", question: "Вопрос", tags: []string{"big data"}},
+		{in: "Пишу на #go и #c++", question: "Пишу на #go и #c++", tags: []string{"go", "c++"}},
+		{in: "#SQL: как сделать JOIN?", question: "#SQL: как сделать JOIN?", tags: []string{"SQL"}},
+		// знаки препинания после хэштега не входят в тег
+		{in: "Пишу на #go.", question: "Пишу на #go.", tags: []string{"go"}},
+		{in: "Что лучше, #node.js или #go-?", question: "Что лучше, #node.js или #go-?", tags: []string{"node.js", "go"}},
+		{in: "Вопрос #... без тега ~ sql", question: "Вопрос #... без тега", tags: []string{"sql"}},
+		{in: "Don't panic ~ go", question: "Don't panic", tags: []string{"go"}},
+		{in: "Кто-то#go", err: "tags_required"},
+		{in: "Вопрос без тегов", err: "tags_required"},
+		{in: "Вопрос #.", err: "tags_required"},
+		{in: "Вопрос ~ " + strings.Repeat("я", maxTagLength), question: "Вопрос", tags: []string{strings.Repeat("я", maxTagLength)}},
+		{in: "Вопрос ~ #" + strings.Repeat("я", maxTagLength+1), err: "tag_too_long"},
+		{in: "Вопрос #" + strings.Repeat("x", maxTagLength+1) + " ~ go", err: "tag_too_long"},
+		{in: " ~ go", err: "question_empty"},
+		{in: "Вопрос ~ 'go", err: "quote_not_closed"},
+	}
+	for _, tt := range tests {
+		question, tags, err := parseQuestion(tt.in)
+		if key := errorKey(err); key != tt.err {
+			t.Errorf("parseQuestion(%q): ошибка %q, ожидалась %q", tt.in, key, tt.err)
+			continue
+		}
+		if question != tt.question || !slices.Equal(tags, tt.tags) {
+			t.Errorf("parseQuestion(%q) = %q, %q, ожидалось %q, %q", tt.in, question, tags, tt.question, tt.tags)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package bot_data
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// maxCommunityNameLength - ограничение на длину названия сообщества
+const maxCommunityNameLength = 64
+
+// communityArg превращает номер сообщества в параметр запроса: общее
+// пространство (0) хранится в базе как NULL.
+func communityArg(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// communityFilter - условие на колонку community_id для параметра $n,
+// переданного через communityArg.
+func communityFilter(column string, n int) string {
+	return column + " IS NOT DISTINCT FROM $" + strconv.Itoa(n)
+}
+
+// visibleFilter - вопрос виден пользователю ($n), если он не удалён и находится
+// в общем пространстве или в сообществе, где состоит пользователь.
+func visibleFilter(alias string, n int) string {
+	return `(` + alias + `.deleted_at IS NULL AND (` + alias + `.community_id IS NULL OR EXISTS (
+		SELECT 1 FROM public.communitymembers cm
+		WHERE cm.community_id = ` + alias + `.community_id AND cm.user_id = $` + strconv.Itoa(n) + `)))`
+}
+
+// isQuestionVisible проверяет, что вопрос существует и доступен пользователю.
+func (b *Bot) isQuestionVisible(userID, questionID int64) bool {
+	if !b.isQuestionExist(questionID) {
+		return false
+	}
+	query := `SELECT EXISTS (SELECT 1 FROM public.questions q WHERE q.question_id = $1 AND ` + visibleFilter("q", 2) + `);`
+	var visible bool
+	if err := b.dtbase.Db.QueryRow(query, questionID, userID).Scan(&visible); err != nil {
+		log.Printf("Ошибка при проверке доступа к вопросу: %v", err)
+	}
+	return visible
+}
+
+// isAnswerVisible - ответ доступен, если доступен его вопрос.
+func (b *Bot) isAnswerVisible(userID, answerID int64) bool {
+	if !b.isAnswerExist(answerID) {
+		return false
+	}
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM public.answers a
+			JOIN public.questions q ON q.question_id = a.question_id
+			WHERE a.answer_id = $1 AND ` + visibleFilter("q", 2) + `
+		);
+	`
+	var visible bool
+	if err := b.dtbase.Db.QueryRow(query, answerID, userID).Scan(&visible); err != nil {
+		log.Printf("Ошибка при проверке доступа к ответу: %v", err)
+	}
+	return visible
+}
+
+func (b *Bot) isMember(userID, communityID int64) bool {
+	var member bool
+	query := "SELECT EXISTS (SELECT 1 FROM public.communitymembers WHERE community_id = $1 AND user_id = $2);"
+	if err := b.dtbase.Db.QueryRow(query, communityID, userID).Scan(&member); err != nil {
+		log.Printf("Ошибка при проверке участника сообщества: %v", err)
+	}
+	return member
+}
+
+func addMember(q dbtx, userID, communityID int64) error {
+	query := `
+		INSERT INTO public.communitymembers (community_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+	`
+	res, err := q.Exec(query, communityID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return audit(q, userID, AuditCommunityJoin, auditTargetCommunity, communityID, nil, nil)
+	}
+	return nil
+}
+
+// setActiveCommunity меняет активное сообщество пользователя. Кэш настроек
+// сбрасывает вызывающий после фиксации транзакции.
+func setActiveCommunity(q dbtx, userID, communityID int64) error {
+	before := readSettings(q, userID).CommunityID
+	if err := setSettingColumn(q, userID, "community_id", communityArg(communityID)); err != nil {
+		return err
+	}
+	return audit(q, userID, AuditCommunitySwitch, auditTargetUser, userID,
+		map[string]int64{"community_id": before}, map[string]int64{"community_id": communityID})
+}
+
+func (b *Bot) chatCommunity(chatID int64) int64 {
+	var id int64
+	err := b.dtbase.Db.QueryRow("SELECT community_id FROM public.communities WHERE chat_id = $1;", chatID).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Ошибка при поиске сообщества чата: %v", err)
+	}
+	return id
+}
+
+// scope - сообщество, в котором выполняется команда. В личных сообщениях это
+// активное сообщество пользователя, в группе - сообщество, привязанное к чату,
+// или общее пространство. Активное сообщество в группе не используется: иначе
+// вопросы закрытого сообщества попали бы в чат, где его участники не все.
+func (b *Bot) scope(userID int64, chat *tgbotapi.Chat) int64 {
+	if IsGroup(chat) {
+		return b.chatCommunity(chat.ID)
+	}
+	return b.settings(userID).CommunityID
+}
+
+// EnterChat вызывается перед обработкой команды. Если группа привязана к сообществу,
+// автор команды становится его участником, чтобы видеть вопросы, заданные в этой группе.
+func (b *Bot) EnterChat(m *tgbotapi.Message) {
+	if !IsGroup(m.Chat) || m.From == nil || !b.checkRegistration(m.From.ID) {
+		return
+	}
+	id := b.chatCommunity(m.Chat.ID)
+	if id == 0 {
+		return
+	}
+	err := b.inTx(func(tx *sql.Tx) error {
+		return addMember(tx, m.From.ID, id)
+	})
+	if err != nil {
+		log.Printf("Ошибка при добавлении участника сообщества: %v", err)
+	}
+}
+
+func newInviteCode() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(buf)), nil
+}
+
+// Community_Create создаёт сообщество. В группе оно привязывается к этому чату
+// (это могут сделать администраторы группы), в личных сообщениях в него можно
+// вступить по коду приглашения.
+func (b *Bot) Community_Create(u *tgbotapi.User, chat *tgbotapi.Chat, name string) string {
+	if !b.checkRegistration(u.ID) {
+		return b.T(u.ID, "not_registered")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > maxCommunityNameLength {
+		return b.T(u.ID, "community_bad_name", maxCommunityNameLength)
+	}
+
+	var chatID interface{}
+	if IsGroup(chat) {
+		if !b.isChatAdmin(chat.ID, u.ID) {
+			return b.T(u.ID, "chat_admins_only")
+		}
+		if b.chatCommunity(chat.ID) != 0 {
+			return b.T(u.ID, "community_chat_bound")
+		}
+		chatID = chat.ID
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		log.Printf("Ошибка при создании кода приглашения: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	query := `
+		INSERT INTO public.communities (name, chat_id, invite_code, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING community_id;
+	`
+	var id int64
+	err = b.inTx(func(tx *sql.Tx) error {
+		if err := tx.QueryRow(query, name, chatID, code, u.ID).Scan(&id); err != nil {
+			return err
+		}
+		if err := audit(tx, u.ID, AuditCommunityCreate, auditTargetCommunity, id, nil, map[string]interface{}{"name": name, "chat_id": chatID}); err != nil {
+			return err
+		}
+		if err := addMember(tx, u.ID, id); err != nil {
+			return err
+		}
+		return setActiveCommunity(tx, u.ID, id)
+	})
+	b.cache.settings.Delete(u.ID)
+	if err != nil {
+		log.Printf("Ошибка при создании сообщества: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	return b.T(u.ID, "community_created", name, id, code)
+}
+
+// Community_Join - вступление в сообщество по коду приглашения.
+func (b *Bot) Community_Join(u *tgbotapi.User, code string) string {
+	if !b.checkRegistration(u.ID) {
+		return b.T(u.ID, "not_registered")
+	}
+	var id int64
+	var name string
+	err := b.dtbase.Db.QueryRow("SELECT community_id, name FROM public.communities WHERE invite_code = $1;", strings.ToLower(code)).Scan(&id, &name)
+	if err == sql.ErrNoRows {
+		return b.T(u.ID, "community_bad_code")
+	}
+	if err != nil {
+		log.Printf("Ошибка при поиске сообщества: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	err = b.inTx(func(tx *sql.Tx) error {
+		if err := addMember(tx, u.ID, id); err != nil {
+			return err
+		}
+		return setActiveCommunity(tx, u.ID, id)
+	})
+	b.cache.settings.Delete(u.ID)
+	if err != nil {
+		log.Printf("Ошибка при добавлении участника сообщества: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	return b.T(u.ID, "community_joined", name)
+}
+
+// Community_Switch делает активным сообщество с номером arg. 0 - общее пространство.
+func (b *Bot) Community_Switch(u *tgbotapi.User, arg string) string {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id < 0 {
+		return b.T(u.ID, "community_bad_id")
+	}
+	if id != 0 && !b.isMember(u.ID, id) {
+		return b.T(u.ID, "community_not_member")
+	}
+	err = b.inTx(func(tx *sql.Tx) error {
+		return setActiveCommunity(tx, u.ID, id)
+	})
+	b.cache.settings.Delete(u.ID)
+	if err != nil {
+		log.Printf("Ошибка при смене активного сообщества: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	if id == 0 {
+		return b.T(u.ID, "community_switched_global")
+	}
+	return b.T(u.ID, "community_switched", id)
+}
+
+// Community_Leave - выход из сообщества. Если оно было активным, активным
+// становится общее пространство.
+func (b *Bot) Community_Leave(u *tgbotapi.User, arg string) string {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id <= 0 {
+		return b.T(u.ID, "community_bad_id")
+	}
+	member := false
+	err = b.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("DELETE FROM public.communitymembers WHERE community_id = $1 AND user_id = $2;", id, u.ID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		member = true
+		if err := audit(tx, u.ID, AuditCommunityLeave, auditTargetCommunity, id, nil, nil); err != nil {
+			return err
+		}
+		if readSettings(tx, u.ID).CommunityID != id {
+			return nil
+		}
+		return setActiveCommunity(tx, u.ID, 0)
+	})
+	b.cache.settings.Delete(u.ID)
+	if err != nil {
+		log.Printf("Ошибка при выходе из сообщества: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	if !member {
+		return b.T(u.ID, "community_not_member")
+	}
+	return b.T(u.ID, "community_left", id)
+}
+
+// Communities показывает сообщества пользователя и отмечает то, в котором
+// выполняются команды в этом чате. Коды приглашения видны только в личных
+// сообщениях, чтобы не раскрыть закрытые сообщества участникам группы.
+func (b *Bot) Communities(u *tgbotapi.User, chat *tgbotapi.Chat) string {
+	s := b.settings(u.ID)
+	group := IsGroup(chat)
+	active := b.scope(u.ID, chat)
+	query := `
+		SELECT c.community_id, c.name, c.invite_code
+		FROM public.communities c
+		JOIN public.communitymembers m ON m.community_id = c.community_id
+		WHERE m.user_id = $1
+		ORDER BY c.name;
+	`
+	rows, err := b.dtbase.Db.Query(query, u.ID)
+	if err != nil {
+		log.Printf("Ошибка при получении списка сообществ: %v", err)
+		return tr(s.Locale, "error_retry")
+	}
+	defer rows.Close()
+
+	result := tr(s.Locale, "communities_header")
+	result += communityLine(s.Locale, active == 0, tr(s.Locale, "community_global"), 0, "")
+	for rows.Next() {
+		var id int64
+		var name, code string
+		if err := rows.Scan(&id, &name, &code); err != nil {
+			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
+		}
+		if group {
+			code = ""
+		}
+		result += communityLine(s.Locale, active == id, name, id, code)
+	}
+	if group {
+		return result + tr(s.Locale, "communities_group_hint")
+	}
+	return result + tr(s.Locale, "communities_hint")
+}
+
+func communityLine(locale string, active bool, name string, id int64, code string) string {
+	marker := "  "
+	if active {
+		marker = "✓ "
+	}
+	line := marker + tr(locale, "community_entry", id, name)
+	if code != "" {
+		line += tr(locale, "community_invite", code)
+	}
+	return line + "\n"
+}
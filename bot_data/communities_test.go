@@ -0,0 +1,136 @@
+package bot_data
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+func TestCommunityVisibility(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice, bob := testUser(1, "alice"), testUser(2, "bob")
+		b.Start(alice)
+		b.Start(bob)
+
+		public := ask(t, b, alice, "Как устроен map? #go")
+		b.Community_Create(alice, nil, "Команда")
+		var id int64
+		var code string
+		err := b.dtbase.Db.QueryRow("SELECT community_id, invite_code FROM public.communities;").Scan(&id, &code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		private := ask(t, b, alice, "Где лежат ключи от стенда? #infra")
+
+		ids := func(community int64) []int64 {
+			t.Helper()
+			list, _, err := b.ListQuestions(QuestionFilter{CommunityID: community, Order: OrderNewest, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result []int64
+			for _, q := range list {
+				result = append(result, q.ID)
+			}
+			return result
+		}
+		if got := ids(0); len(got) != 1 || got[0] != public {
+			t.Errorf("общее пространство: %v", got)
+		}
+		if got := ids(id); len(got) != 1 || got[0] != private {
+			t.Errorf("сообщество: %v", got)
+		}
+		if _, err := b.Question(0, private); err != ErrNotFound {
+			t.Errorf("вопрос сообщества виден в общем пространстве: %v", err)
+		}
+
+		expect(t, b.Like_Question(bob, strconv.FormatInt(private, 10)), "question_not_found")
+		expect(t, b.Community_Join(bob, code), "community_joined", "Команда")
+		expect(t, b.Like_Question(bob, strconv.FormatInt(private, 10)), "like_added")
+
+		// теги и профиль считаются только по вопросам своего сообщества
+		for community, want := range map[int64]string{0: "go", id: "infra"} {
+			tags, total, err := b.ListTags(community, 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 1 || len(tags) != 1 || tags[0].Name != want {
+				t.Errorf("теги сообщества %d: %d, %+v", community, total, tags)
+			}
+		}
+		answer(t, b, bob, private, "В сейфе")
+		for community, want := range map[int64][3]int{0: {1, 0, 0}, id: {1, 0, 1}} {
+			p, err := b.UserProfile(community, alice.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := [3]int{p.Questions, p.Answers, p.Likes}; got != want {
+				t.Errorf("профиль в сообществе %d: %v, ожидалось %v", community, got, want)
+			}
+		}
+		if p, _ := b.UserProfile(id, bob.ID); p.Answers != 1 {
+			t.Errorf("ответов bob в сообществе: %d", p.Answers)
+		}
+		if p, _ := b.UserProfile(0, bob.ID); p.Answers != 0 {
+			t.Errorf("ответов bob в общем пространстве: %d", p.Answers)
+		}
+		if _, err := b.UserProfile(0, 100); err != ErrNotFound {
+			t.Errorf("профиль несуществующего пользователя: %v", err)
+		}
+	})
+}
+
+func TestGroupScope(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice := testUser(1, "alice")
+		b.Start(alice)
+		b.Community_Create(alice, nil, "Команда")
+		var code string
+		if err := b.dtbase.Db.QueryRow("SELECT invite_code FROM public.communities;").Scan(&code); err != nil {
+			t.Fatal(err)
+		}
+		ask(t, b, alice, "Где лежат ключи от стенда? #infra")
+
+		// коды приглашения не попадают в группу
+		group := &tgbotapi.Chat{ID: -100, Type: "group"}
+		if list := b.Communities(alice, nil); !strings.Contains(list, code) {
+			t.Errorf("в личных сообщениях нет кода приглашения: %q", list)
+		}
+		if list := b.Communities(alice, group); strings.Contains(list, code) {
+			t.Errorf("код приглашения показан в группе: %q", list)
+		}
+
+		// в группе без сообщества команды работают в общем пространстве,
+		// а не в активном сообществе пользователя
+		found := func(chat *tgbotapi.Chat, tag, text string) bool {
+			t.Helper()
+			return strings.Contains(strings.Join(b.Questions(alice, chat, tag).Records, ""), text)
+		}
+		if !found(nil, "infra", "ключи от стенда") {
+			t.Error("вопрос активного сообщества не найден в личных сообщениях")
+		}
+		if found(group, "infra", "ключи от стенда") {
+			t.Error("вопрос закрытого сообщества показан в группе")
+		}
+		b.Ask(alice, group, "Как настроить линтер? #lint", nil)
+		if !found(group, "lint", "настроить линтер") || found(nil, "lint", "настроить линтер") {
+			t.Error("вопрос из группы без сообщества попал не в общее пространство")
+		}
+
+		// в группе, привязанной к сообществу, - сообщество чата
+		bound := &tgbotapi.Chat{ID: -200, Type: "supergroup"}
+		var id int64
+		query := "INSERT INTO public.communities (name, chat_id, invite_code, created_by) VALUES ('Чат', $1, 'chatcode', $2) RETURNING community_id;"
+		if err := b.dtbase.Db.QueryRow(query, bound.ID, alice.ID).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.scope(alice.ID, bound); got != id {
+			t.Errorf("сообщество группы %d, ожидалось %d", got, id)
+		}
+		if found(bound, "infra", "ключи от стенда") {
+			t.Error("вопрос активного сообщества показан в чужой группе")
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package bot_data
+
+import (
+	"database/sql"
+	"log"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// RecountCounters сверяет счётчики лайков и ответов с таблицами лайков и ответов
+// (плюс лайки, перенесённые импортом) и исправляет расхождения. Возвращает
+// число исправленных вопросов и ответов. Обычно счётчики поддерживают триггеры,
+// пересчёт нужен после ручных правок базы.
+func (b *Bot) RecountCounters() (questions, answers int64, err error) {
+	err = b.inTx(func(tx *sql.Tx) error {
+		questions, answers, err = recountCounters(tx)
+		return err
+	})
+	return questions, answers, err
+}
+
+func recountCounters(tx dbtx) (questions, answers int64, err error) {
+	res, err := tx.Exec(`
+		UPDATE public.questions AS q SET like_count = c.likes, answer_count = c.answers
+		FROM (
+			SELECT q.question_id,
+				(SELECT COUNT(*) FROM public.questionlikes ql WHERE ql.question_id = q.question_id) + q.imported_likes AS likes,
+				(SELECT COUNT(*) FROM public.answers a WHERE a.question_id = q.question_id) AS answers
+			FROM public.questions q
+		) c
+		WHERE q.question_id = c.question_id AND (q.like_count <> c.likes OR q.answer_count <> c.answers);
+	`)
+	if err != nil {
+		return 0, 0, err
+	}
+	questions, _ = res.RowsAffected()
+
+	res, err = tx.Exec(`
+		UPDATE public.answers AS a SET like_count = c.likes
+		FROM (
+			SELECT a.answer_id,
+				(SELECT COUNT(*) FROM public.answerlikes al WHERE al.answer_id = a.answer_id) + a.imported_likes AS likes
+			FROM public.answers a
+		) c
+		WHERE a.answer_id = c.answer_id AND a.like_count <> c.likes;
+	`)
+	if err != nil {
+		return 0, 0, err
+	}
+	answers, _ = res.RowsAffected()
+	return questions, answers, nil
+}
+
+// Recount пересчитывает счётчики по команде. Доступно администраторам.
+func (b *Bot) Recount(u *tgbotapi.User) string {
+	if !isAdmin(u.ID) {
+		return b.T(u.ID, "admins_only")
+	}
+	var questions, answers int64
+	err := b.inTx(func(tx *sql.Tx) (err error) {
+		if questions, answers, err = recountCounters(tx); err != nil {
+			return err
+		}
+		return audit(tx, u.ID, AuditRecount, "", "", nil, map[string]int64{"questions": questions, "answers": answers})
+	})
+	if err != nil {
+		log.Printf("Ошибка при пересчёте счётчиков: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	return b.T(u.ID, "counters_fixed", questions, answers)
+}
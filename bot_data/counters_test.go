@@ -0,0 +1,47 @@
+package bot_data
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRecountCounters(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice, bob := testUser(1, "alice"), testUser(2, "bob")
+		b.Start(alice)
+		b.Start(bob)
+		qid := ask(t, b, alice, "Зачем нужен context? #go")
+		aid := answer(t, b, bob, qid, "Для отмены и дедлайнов")
+		b.Like_Question(bob, strconv.FormatInt(qid, 10))
+		b.Like_Answer(alice, strconv.FormatInt(aid, 10))
+
+		questions, answers, err := b.RecountCounters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if questions != 0 || answers != 0 {
+			t.Fatalf("триггеры оставили расхождения: %d вопросов, %d ответов", questions, answers)
+		}
+
+		if _, err := b.dtbase.Db.Exec("UPDATE public.questions SET like_count = 7, answer_count = 0;"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.dtbase.Db.Exec("UPDATE public.answers SET like_count = 0;"); err != nil {
+			t.Fatal(err)
+		}
+		questions, answers, err = b.RecountCounters()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if questions != 1 || answers != 1 {
+			t.Fatalf("исправлено %d вопросов и %d ответов, ожидалось по одному", questions, answers)
+		}
+		q, err := b.Question(0, qid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.Likes != 1 || q.Answers != 1 || q.AnswerList[0].Likes != 1 {
+			t.Errorf("после пересчёта: лайков %d, ответов %d, лайков ответа %d", q.Likes, q.Answers, q.AnswerList[0].Likes)
+		}
+	})
+}
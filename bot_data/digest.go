@@ -0,0 +1,309 @@
+package bot_data
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// digestPeriods задаёт допустимые частоты дайджеста и их период.
+var digestPeriods = map[string]time.Duration{
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+func (b *Bot) Subscribe(u *tgbotapi.User, arg string) string {
+	exist := b.checkRegistration(u.ID)
+	if !exist {
+		return b.T(u.ID, "not_registered")
+	}
+	arg = b.canonicalTag(arg)
+	tag_id := b.tagID(arg)
+	if tag_id == 0 {
+		return b.T(u.ID, "tag_not_found")
+	}
+	query := `
+		INSERT INTO public.tagsubscriptions (user_id, tag_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+	`
+	subscribed := false
+	err := b.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(query, u.ID, tag_id)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		subscribed = true
+		return audit(tx, u.ID, AuditTagSubscribe, auditTargetTag, arg, nil, nil)
+	})
+	if err != nil {
+		log.Printf("Ошибка при подписке на тег: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	if !subscribed {
+		return b.T(u.ID, "already_subscribed", arg)
+	}
+	return b.T(u.ID, "subscribed", arg)
+}
+
+func (b *Bot) Unsubscribe(u *tgbotapi.User, arg string) string {
+	arg = b.canonicalTag(arg)
+	query := `
+		DELETE FROM public.tagsubscriptions
+		WHERE user_id = $1 AND tag_id = (SELECT tag_id FROM public.tags WHERE tag_name = $2);
+	`
+	subscribed := false
+	err := b.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(query, u.ID, arg)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		subscribed = true
+		return audit(tx, u.ID, AuditTagUnsubscribe, auditTargetTag, arg, nil, nil)
+	})
+	if err != nil {
+		log.Printf("Ошибка при отписке от тега: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	if !subscribed {
+		return b.T(u.ID, "not_subscribed")
+	}
+	return b.T(u.ID, "unsubscribed", arg)
+}
+
+func (b *Bot) Digest(u *tgbotapi.User, arg string) string {
+	exist := b.checkRegistration(u.ID)
+	if !exist {
+		return b.T(u.ID, "not_registered")
+	}
+	if _, ok := digestPeriods[arg]; !ok && arg != "off" {
+		return b.T(u.ID, "digest_bad_frequency")
+	}
+	err := b.changeSettings(u.ID, func(tx *sql.Tx) error {
+		return setDigestFrequency(tx, u.ID, arg)
+	})
+	if err != nil {
+		log.Printf("Ошибка при сохранении настроек дайджеста: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	if arg == "off" {
+		return b.T(u.ID, "digest_off")
+	}
+	return b.T(u.ID, "digest_on", arg)
+}
+
+func setDigestFrequency(q dbtx, userID int64, frequency string) error {
+	query := `
+		INSERT INTO public.digestsettings (user_id, frequency)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET frequency = EXCLUDED.frequency;
+	`
+	_, err := q.Exec(query, userID, frequency)
+	return err
+}
+
+// RunDigests периодически рассылает дайджесты пользователям, у которых подошёл срок.
+func (b *Bot) RunDigests(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		b.sendDueDigests()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Bot) sendDueDigests() {
+	if !b.Available() {
+		return
+	}
+	query := `
+		SELECT user_id, frequency, last_sent_at
+		FROM public.digestsettings
+		WHERE (frequency = 'daily' AND (last_sent_at IS NULL OR last_sent_at <= $1))
+		   OR (frequency = 'weekly' AND (last_sent_at IS NULL OR last_sent_at <= $2));
+	`
+	now := time.Now()
+	rows, err := b.dtbase.Db.Query(query, now.AddDate(0, 0, -1), now.AddDate(0, 0, -7))
+	if err != nil {
+		log.Printf("Ошибка при поиске пользователей для дайджеста: %v", err)
+		return
+	}
+
+	type due struct {
+		userID    int64
+		frequency string
+		lastSent  *time.Time
+	}
+	var users []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.userID, &d.frequency, &d.lastSent); err != nil {
+			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
+		}
+		users = append(users, d)
+	}
+	rows.Close()
+
+	for _, d := range users {
+		since := time.Now().Add(-digestPeriods[d.frequency])
+		if d.lastSent != nil {
+			since = *d.lastSent
+		}
+
+		if err := b.SendReply(d.userID, b.buildDigest(d.userID, since)); err != nil {
+			log.Printf("Ошибка при отправке дайджеста пользователю %d: %v", d.userID, err)
+			continue
+		}
+
+		_, err := b.dtbase.Db.Exec("UPDATE public.digestsettings SET last_sent_at = NOW() WHERE user_id = $1;", d.userID)
+		if err != nil {
+			log.Printf("Ошибка при обновлении времени дайджеста: %v", err)
+		}
+	}
+}
+
+// buildDigest собирает дайджест за период с since, по одной записи на раздел.
+// Пустой ответ означает, что новостей для пользователя нет.
+func (b *Bot) buildDigest(userID int64, since time.Time) Reply {
+	s := b.settings(userID)
+	locale := s.Locale
+	f := b.format
+	result := Reply{Format: f}
+
+	tags := b.subscribedTags(userID)
+	for _, tag := range tags {
+		rows, err := b.topQuestions(s.CommunityID, tag, since, 5)
+		if err != nil {
+			log.Printf("Ошибка при поиске вопросов для дайджеста: %v", err)
+			continue
+		}
+		var section string
+		for _, q := range scanQuestions(rows) {
+			section += trf(f, locale, "digest_question_entry", q.ID, q.Text, q.Likes)
+		}
+		rows.Close()
+		if section != "" {
+			result.Records = append(result.Records, boldLine(f, tr(locale, "digest_new_questions", tag))+section+"\n")
+		}
+	}
+
+	if len(tags) > 0 {
+		if section := b.unansweredForUser(f, locale, userID, s.CommunityID); section != "" {
+			result.Records = append(result.Records, boldLine(f, tr(locale, "digest_unanswered"))+section+"\n")
+		}
+	}
+
+	if section := b.ownActivity(f, locale, userID, since); section != "" {
+		result.Records = append(result.Records, boldLine(f, tr(locale, "digest_activity"))+section+"\n")
+	}
+
+	if result.Empty() {
+		return Reply{}
+	}
+	result.Records = append([]string{boldLine(f, tr(locale, "digest_title"))}, result.Records...)
+	return result
+}
+
+func (b *Bot) subscribedTags(userID int64) []string {
+	query := `
+		SELECT t.tag_name
+		FROM public.tagsubscriptions s
+		JOIN public.tags t ON s.tag_id = t.tag_id
+		WHERE s.user_id = $1
+		ORDER BY t.tag_name;
+	`
+	rows, err := b.dtbase.Db.Query(query, userID)
+	if err != nil {
+		log.Printf("Ошибка при поиске подписок: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func (b *Bot) unansweredForUser(f Formatter, locale string, userID, community int64) string {
+	query := `
+		SELECT DISTINCT q.question_id, q.question_text
+		FROM public.questions q
+		JOIN public.questiontags qt ON q.question_id = qt.question_id
+		JOIN public.tagsubscriptions s ON s.tag_id = qt.tag_id AND s.user_id = $1
+		WHERE q.is_closed = false AND q.deleted_at IS NULL AND q.user_id <> $1 AND ` + communityFilter("q.community_id", 2) + `
+		  AND q.answer_count = 0
+		ORDER BY q.question_id DESC
+		LIMIT 5;
+	`
+	rows, err := b.dtbase.Db.Query(query, userID, communityArg(community))
+	if err != nil {
+		log.Printf("Ошибка при поиске вопросов без ответов: %v", err)
+		return ""
+	}
+	defer rows.Close()
+
+	var result string
+	for rows.Next() {
+		var id int64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
+		}
+		result += trf(f, locale, "digest_entry", id, text)
+	}
+	return result
+}
+
+func (b *Bot) ownActivity(f Formatter, locale string, userID int64, since time.Time) string {
+	query := `
+		SELECT q.question_id, q.question_text, COUNT(a.answer_id) AS new_answers
+		FROM public.questions q
+		JOIN public.answers a ON a.question_id = q.question_id
+		WHERE q.user_id = $1 AND q.deleted_at IS NULL AND a.created_at >= $2
+		GROUP BY q.question_id, q.question_text
+		ORDER BY new_answers DESC;
+	`
+	rows, err := b.dtbase.Db.Query(query, userID, since)
+	if err != nil {
+		log.Printf("Ошибка при поиске активности по вопросам: %v", err)
+		return ""
+	}
+	defer rows.Close()
+
+	var result string
+	for rows.Next() {
+		var id int64
+		var text string
+		var count int
+		if err := rows.Scan(&id, &text, &count); err != nil {
+			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
+		}
+		result += trf(f, locale, "digest_activity_entry", id, text, count)
+	}
+	return result
+}
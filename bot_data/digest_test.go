@@ -0,0 +1,17 @@
+package bot_data
+
+import "testing"
+
+func TestSubscribe(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice := testUser(1, "alice")
+		b.Start(alice)
+		ask(t, b, alice, "Зачем нужен context? #go")
+
+		expect(t, b.Subscribe(alice, "rust"), "tag_not_found")
+		expect(t, b.Subscribe(alice, "#Go"), "subscribed", "go")
+		expect(t, b.Subscribe(alice, "go"), "already_subscribed", "go")
+		expect(t, b.Unsubscribe(alice, "go"), "unsubscribed", "go")
+		expect(t, b.Unsubscribe(alice, "go"), "not_subscribed")
+	})
+}
@@ -0,0 +1,156 @@
+package bot_data
+
+import (
+	"QADots/database"
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+const (
+	// similarityThreshold - минимальная похожесть (pg_trgm), при которой вопрос считается возможным дубликатом
+	similarityThreshold = 0.3
+	// pendingTTL - сколько ждём подтверждения публикации вопроса
+	pendingTTL = 10 * time.Minute
+
+	callbackAskConfirm = "ask_confirm"
+	callbackAskCancel  = "ask_cancel"
+	callbackOpen       = "open:"
+)
+
+type pendingQuestion struct {
+	text        string
+	tags        []string
+	attachments []Attachment
+	// communityID - сообщество, в котором задан вопрос
+	communityID int64
+	created     time.Time
+}
+
+type duplicate struct {
+	questionID  int64
+	text        string
+	answerCount int
+}
+
+func (b *Bot) setPending(userID int64, p pendingQuestion) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[userID] = p
+}
+
+func (b *Bot) takePending(userID int64) (pendingQuestion, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.pending[userID]
+	delete(b.pending, userID)
+	if !ok || time.Since(p.created) > pendingTTL {
+		return pendingQuestion{}, false
+	}
+	return p, true
+}
+
+// similarQuestions ищет до трёх похожих вопросов сообщества по триграммам.
+func (b *Bot) similarQuestions(community int64, text string) []duplicate {
+	var q dbtx = b.dtbase.Db
+	filter := "similarity(q.question_text, $1) >= $3"
+	args := []interface{}{text, communityArg(community), similarityThreshold}
+	if b.dtbase.Driver == database.DriverPostgres {
+		// индекс questions_text_trgm_idx работает только с оператором %, а его порог -
+		// настройка pg_trgm.similarity_threshold, поэтому она задаётся на время транзакции
+		tx, err := b.dtbase.Db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			log.Printf("Ошибка при поиске похожих вопросов: %v", err)
+			return nil
+		}
+		defer tx.Rollback()
+		threshold := strconv.FormatFloat(similarityThreshold, 'f', -1, 64)
+		if _, err := tx.Exec("SELECT set_config('pg_trgm.similarity_threshold', $1, true);", threshold); err != nil {
+			log.Printf("Ошибка при поиске похожих вопросов: %v", err)
+			return nil
+		}
+		q, filter, args = tx, "q.question_text % $1", args[:2]
+	}
+
+	query := `
+		SELECT q.question_id, q.question_text, q.answer_count
+		FROM public.questions q
+		WHERE ` + filter + ` AND q.deleted_at IS NULL AND ` + communityFilter("q.community_id", 2) + `
+		ORDER BY similarity(q.question_text, $1) DESC
+		LIMIT 3;
+	`
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		log.Printf("Ошибка при поиске похожих вопросов: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var result []duplicate
+	for rows.Next() {
+		var d duplicate
+		if err := rows.Scan(&d.questionID, &d.text, &d.answerCount); err != nil {
+			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+func duplicatesMessage(f Formatter, locale string, duplicates []duplicate) string {
+	var sb strings.Builder
+	sb.WriteString(boldLine(f, tr(locale, "duplicates_header")))
+	for _, d := range duplicates {
+		sb.WriteString(trf(f, locale, "duplicate_entry", d.questionID, content(f, d.text), d.answerCount))
+	}
+	sb.WriteString(trf(f, locale, "duplicates_footer"))
+	return sb.String()
+}
+
+func duplicatesKeyboard(locale string, duplicates []duplicate) *tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, d := range duplicates {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(tr(locale, "button_open", d.questionID), callbackOpen+strconv.FormatInt(d.questionID, 10)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(tr(locale, "button_post_anyway"), callbackAskConfirm),
+		tgbotapi.NewInlineKeyboardButtonData(tr(locale, "button_cancel"), callbackAskCancel),
+	))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &keyboard
+}
+
+// HandleCallback обрабатывает нажатия на inline-кнопки и возвращает ответ.
+// Пустой ответ означает, что отвечать отдельным сообщением не нужно.
+func (b *Bot) HandleCallback(q *tgbotapi.CallbackQuery) Reply {
+	switch {
+	case q.Data == callbackAskConfirm:
+		p, ok := b.takePending(q.From.ID)
+		if !ok {
+			return Text(b.T(q.From.ID, "no_pending"))
+		}
+		return Text(b.postQuestion(q.From, p.communityID, p.text, p.tags, p.attachments))
+
+	case q.Data == callbackAskCancel:
+		b.takePending(q.From.ID)
+		return Text(b.T(q.From.ID, "ask_cancelled"))
+
+	case strings.HasPrefix(q.Data, callbackOpen):
+		b.takePending(q.From.ID)
+		return b.Get_Answers(q.From, strings.TrimPrefix(q.Data, callbackOpen))
+
+	case strings.HasPrefix(q.Data, callbackSettings):
+		return Text(b.handleSettingsCallback(q))
+
+	default:
+		return Text(b.T(q.From.ID, "unknown_command"))
+	}
+}
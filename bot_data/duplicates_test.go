@@ -0,0 +1,30 @@
+package bot_data
+
+import "testing"
+
+func TestSimilarQuestions(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice := testUser(1, "alice")
+		b.Start(alice)
+		qid := ask(t, b, alice, "Как отсортировать срез структур по полю? #go")
+		ask(t, b, alice, "Почему падает миграция базы? #sql")
+
+		found := b.similarQuestions(0, "Как отсортировать срез структур по двум полям?")
+		if len(found) != 1 || found[0].questionID != qid {
+			t.Fatalf("похожие вопросы: %+v", found)
+		}
+		if found := b.similarQuestions(0, "Где взять логотип проекта?"); len(found) != 0 {
+			t.Errorf("непохожий вопрос нашёл %+v", found)
+		}
+		// вопросы другого сообщества не предлагаются
+		if found := b.similarQuestions(1, "Как отсортировать срез структур по полю?"); len(found) != 0 {
+			t.Errorf("вопрос общего пространства предложен в сообществе: %+v", found)
+		}
+
+		// похожий вопрос не публикуется сразу, а ждёт подтверждения
+		r := b.Ask(alice, nil, "Как отсортировать срез структур по полю? ~ go", nil)
+		if r.Markup == nil {
+			t.Errorf("дубликат опубликован без подтверждения: %v", r.Records)
+		}
+	})
+}
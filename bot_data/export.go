@@ -0,0 +1,220 @@
+package bot_data
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"html/template"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// defaultExportFormat - формат файла, который прикладывается к спискам
+const defaultExportFormat = "csv"
+
+// Table - табличные данные для выгрузки. Name используется как имя файла без расширения.
+type Table struct {
+	Name   string
+	Header []string
+	Rows   [][]string
+}
+
+// Exporter записывает таблицу в конкретном формате.
+type Exporter interface {
+	Extension() string
+	Write(w io.Writer, t Table) error
+}
+
+var exporters = map[string]Exporter{
+	"csv":      csvExporter{},
+	"json":     jsonExporter{},
+	"md":       markdownExporter{},
+	"markdown": markdownExporter{},
+	"html":     htmlExporter{},
+}
+
+// LookupExporter возвращает экспортёр по названию формата.
+func LookupExporter(format string) (Exporter, bool) {
+	e, ok := exporters[strings.ToLower(format)]
+	return e, ok
+}
+
+type csvExporter struct{}
+
+func (csvExporter) Extension() string { return "csv" }
+
+func (csvExporter) Write(w io.Writer, t Table) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.Header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(t.Rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+type jsonExporter struct{}
+
+func (jsonExporter) Extension() string { return "json" }
+
+// Write выгружает таблицу как массив объектов, ключи - заголовки столбцов.
+func (jsonExporter) Write(w io.Writer, t Table) error {
+	records := make([]map[string]string, 0, len(t.Rows))
+	for _, row := range t.Rows {
+		record := make(map[string]string, len(t.Header))
+		for i, h := range t.Header {
+			if i < len(row) {
+				record[h] = row[i]
+			}
+		}
+		records = append(records, record)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(records)
+}
+
+type markdownExporter struct{}
+
+func (markdownExporter) Extension() string { return "md" }
+
+var markdownCellReplacer = strings.NewReplacer("|", "\\|", "\r\n", "<br>", "\n", "<br>")
+
+func (markdownExporter) Write(w io.Writer, t Table) error {
+	var sb strings.Builder
+	writeRow := func(cells []string) {
+		sb.WriteString("|")
+		for _, c := range cells {
+			sb.WriteString(" " + markdownCellReplacer.Replace(c) + " |")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("# " + t.Name + "\n\n")
+	writeRow(t.Header)
+	sb.WriteString("|" + strings.Repeat(" --- |", len(t.Header)) + "\n")
+	for _, row := range t.Rows {
+		writeRow(row)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+type htmlExporter struct{}
+
+func (htmlExporter) Extension() string { return "html" }
+
+var htmlExportTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:4px 8px;vertical-align:top;white-space:pre-wrap}</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func (htmlExporter) Write(w io.Writer, t Table) error {
+	return htmlExportTemplate.Execute(w, t)
+}
+
+// ExportFile - таблица, которая отправляется документом вместе с ответом.
+type ExportFile struct {
+	Format string
+	Table  Table
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^\p{L}\p{N}_.-]+`)
+
+// sendExport отправляет таблицу документом в выбранном формате.
+func (b *Bot) sendExport(chatID int64, format string, t Table) error {
+	exporter, ok := LookupExporter(format)
+	if !ok {
+		exporter = exporters[defaultExportFormat]
+	}
+
+	var buffer bytes.Buffer
+	if err := exporter.Write(&buffer, t); err != nil {
+		return err
+	}
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  unsafeFileChars.ReplaceAllString(t.Name, "_") + "." + exporter.Extension(),
+		Bytes: buffer.Bytes(),
+	})
+	_, err := b.API.Send(doc)
+	return err
+}
+
+// Export выгружает список в выбранном формате: args[0] - формат, args[1] - область
+// (questions <тег>, my_questions или answers <номер вопроса>).
+func (b *Bot) Export(u *tgbotapi.User, chat *tgbotapi.Chat, args []string) Reply {
+	s := b.settings(u.ID)
+	format, scope := args[0], args[1]
+	if _, ok := LookupExporter(format); !ok {
+		return Text(tr(s.Locale, "export_bad_format"))
+	}
+
+	var table Table
+	switch scope {
+	case "questions":
+		if len(args) < 3 {
+			return Text(tr(s.Locale, "export_need_tag", format))
+		}
+		tag := b.canonicalTag(args[2])
+		questions, err := b.questionsByTag(b.scope(u.ID, chat), tag)
+		if err != nil {
+			log.Printf("Ошибка при поиске вопросов по данному тегу: %v", err)
+			return Text(tr(s.Locale, "error_retry"))
+		}
+		table = questionsTable(s, tag, questions)
+
+	case "my_questions":
+		if !b.checkRegistration(u.ID) {
+			return Text(tr(s.Locale, "not_registered"))
+		}
+		questions, err := b.userQuestions(u, b.scope(u.ID, chat))
+		if err != nil {
+			log.Printf("Ошибка при поиске ваших вопросов: %v", err)
+			return Text(tr(s.Locale, "error_retry"))
+		}
+		table = myQuestionsTable(s, questions)
+
+	case "answers":
+		if len(args) < 3 {
+			return Text(tr(s.Locale, "export_need_id", format))
+		}
+		q_id, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return Text(tr(s.Locale, "bad_question_id"))
+		}
+		if !b.isQuestionVisible(u.ID, q_id) {
+			return Text(tr(s.Locale, "question_not_found"))
+		}
+		answers, err := b.questionAnswers(q_id)
+		if err != nil {
+			log.Printf("Ошибка при поиске ответов: %v", err)
+			return Text(tr(s.Locale, "error_retry"))
+		}
+		table = answersTable(s, q_id, answers)
+
+	default:
+		return Text(tr(s.Locale, "export_bad_scope"))
+	}
+
+	r := Text(tr(s.Locale, "export_sent"))
+	r.Files = []ExportFile{{Format: format, Table: table}}
+	return r
+}
@@ -0,0 +1,219 @@
+package bot_data
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+var ParseMode = flag.String("tg.parse_mode", "html", "markup of formatted replies: html or markdownv2")
+
+// Formatter размечает текст ответов для Telegram. Все методы, кроме Strip,
+// принимают обычный текст и сами экранируют его.
+type Formatter interface {
+	ParseMode() string
+	Escape(s string) string
+	Bold(s string) string
+	Code(s string) string
+	Pre(s string) string
+	Mention(userID int64, name string) string
+	// Strip убирает разметку, оставляя обычный текст
+	Strip(s string) string
+}
+
+var formatters = map[string]Formatter{
+	"html":       htmlFormatter{},
+	"markdownv2": markdownFormatter{},
+	"markdown":   markdownFormatter{},
+}
+
+// LookupFormatter возвращает форматтер по названию режима разметки.
+func LookupFormatter(mode string) (Formatter, bool) {
+	f, ok := formatters[strings.ToLower(mode)]
+	return f, ok
+}
+
+type htmlFormatter struct{}
+
+func (htmlFormatter) ParseMode() string { return tgbotapi.ModeHTML }
+
+// Escape экранирует только те символы, которые Telegram требует в режиме HTML.
+func (htmlFormatter) Escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func (f htmlFormatter) Bold(s string) string { return "<b>" + f.Escape(s) + "</b>" }
+func (f htmlFormatter) Code(s string) string { return "<code>" + f.Escape(s) + "</code>" }
+func (f htmlFormatter) Pre(s string) string  { return "<pre>" + f.Escape(s) + "</pre>" }
+
+func (f htmlFormatter) Mention(userID int64, name string) string {
+	return `<a href="tg://user?id=` + strconv.FormatInt(userID, 10) + `">` + f.Escape(name) + "</a>"
+}
+
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+func (htmlFormatter) Strip(s string) string {
+	return html.UnescapeString(htmlTagRe.ReplaceAllString(s, ""))
+}
+
+type markdownFormatter struct{}
+
+func (markdownFormatter) ParseMode() string { return tgbotapi.ModeMarkdownV2 }
+
+// markdownSpecial - символы, которые в MarkdownV2 нужно экранировать вне блоков кода
+const markdownSpecial = "_*[]()~`>#+-=|{}.!\\"
+
+func (markdownFormatter) Escape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(markdownSpecial, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// escapeCode экранирует содержимое блоков кода: там значимы только ` и \.
+func (markdownFormatter) escapeCode(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(s)
+}
+
+func (f markdownFormatter) Bold(s string) string { return "*" + f.Escape(s) + "*" }
+func (f markdownFormatter) Code(s string) string { return "`" + f.escapeCode(s) + "`" }
+func (f markdownFormatter) Pre(s string) string  { return "```\n" + f.escapeCode(s) + "\n```" }
+
+func (f markdownFormatter) Mention(userID int64, name string) string {
+	return "[" + f.Escape(name) + "](tg://user?id=" + strconv.FormatInt(userID, 10) + ")"
+}
+
+var (
+	markdownLinkRe  = regexp.MustCompile(`\[((?:\\.|[^\]\\])*)\]\([^)]*\)`)
+	markdownStripRe = regexp.MustCompile("(?s)```\n?(.*?)\n?```|`((?:\\\\.|[^`\\\\])*)`|\\\\(.)|[*_~]|\\|\\|")
+	codeUnescaper   = strings.NewReplacer("\\\\", "\\", "\\`", "`")
+)
+
+func (markdownFormatter) Strip(s string) string {
+	s = markdownLinkRe.ReplaceAllString(s, "$1")
+	return markdownStripRe.ReplaceAllStringFunc(s, func(m string) string {
+		sub := markdownStripRe.FindStringSubmatch(m)
+		switch {
+		case strings.HasPrefix(m, "```"):
+			return codeUnescaper.Replace(sub[1])
+		case strings.HasPrefix(m, "`"):
+			return codeUnescaper.Replace(sub[2])
+		case strings.HasPrefix(m, "\\"):
+			return sub[3]
+		}
+		return ""
+	})
+}
+
+// Markup - уже размеченный фрагмент, который не нужно экранировать повторно.
+type Markup string
+
+// sprintf работает как fmt.Sprintf, но экранирует и текст шаблона, и аргументы.
+// Аргументы типа Markup вставляются как есть.
+func sprintf(f Formatter, format string, args ...interface{}) string {
+	var sb strings.Builder
+	next := 0
+	for i := 0; i < len(format); {
+		j := strings.IndexByte(format[i:], '%')
+		if j < 0 {
+			sb.WriteString(f.Escape(format[i:]))
+			break
+		}
+		sb.WriteString(f.Escape(format[i : i+j]))
+		i += j
+
+		// ищем конец спецификатора: первый символ-букву или второй %
+		k := i + 1
+		for k < len(format) && !isVerb(format[k]) {
+			k++
+		}
+		if k == len(format) {
+			sb.WriteString(f.Escape(format[i:]))
+			break
+		}
+		spec := format[i : k+1]
+		i = k + 1
+		if spec == "%%" {
+			sb.WriteString(f.Escape("%"))
+			continue
+		}
+
+		// явный номер аргумента: %[2]s
+		if open := strings.IndexByte(spec, '['); open >= 0 {
+			if end := strings.IndexByte(spec, ']'); end > open {
+				if n, err := strconv.Atoi(spec[open+1 : end]); err == nil {
+					next = n - 1
+				}
+				spec = spec[:open] + spec[end+1:]
+			}
+		}
+		if next < 0 || next >= len(args) {
+			sb.WriteString(f.Escape(fmt.Sprintf("%%!%c(MISSING)", spec[len(spec)-1])))
+			continue
+		}
+		arg := args[next]
+		next++
+		if m, ok := arg.(Markup); ok {
+			sb.WriteString(string(m))
+			continue
+		}
+		sb.WriteString(f.Escape(fmt.Sprintf(spec, arg)))
+	}
+	return sb.String()
+}
+
+func isVerb(c byte) bool {
+	return c == '%' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// trf - размеченный вариант tr.
+func trf(f Formatter, locale, key string, args ...interface{}) string {
+	return sprintf(f, tr(locale, key), args...)
+}
+
+// boldLine выделяет заголовок, оставляя переводы строк вокруг него без разметки.
+func boldLine(f Formatter, s string) string {
+	trimmed := strings.TrimRight(s, "\n")
+	if trimmed == "" {
+		return s
+	}
+	return f.Bold(trimmed) + s[len(trimmed):]
+}
+
+// codeBlockRe находит в пользовательском тексте блоки ```...``` и `...`
+var codeBlockRe = regexp.MustCompile("(?s)```(?:[a-zA-Z0-9_+-]*\\n)?(.*?)```|`([^`\\n]+)`")
+
+// content размечает текст вопроса или ответа: блоки кода оформляются
+// моноширинным шрифтом, остальное экранируется.
+func content(f Formatter, text string) Markup {
+	var sb strings.Builder
+	last := 0
+	for _, m := range codeBlockRe.FindAllStringSubmatchIndex(text, -1) {
+		sb.WriteString(f.Escape(text[last:m[0]]))
+		if m[2] >= 0 {
+			sb.WriteString(f.Pre(strings.Trim(text[m[2]:m[3]], "\n")))
+		} else {
+			sb.WriteString(f.Code(text[m[4]:m[5]]))
+		}
+		last = m[1]
+	}
+	sb.WriteString(f.Escape(text[last:]))
+	return Markup(sb.String())
+}
+
+// mention - ссылка на профиль пользователя. Без имени выводится его номер.
+func mention(f Formatter, userID int64, name string) Markup {
+	if name == "" {
+		name = strconv.FormatInt(userID, 10)
+	}
+	return Markup(f.Mention(userID, name))
+}
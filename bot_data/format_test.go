@@ -0,0 +1,75 @@
+package bot_data
+
+import "testing"
+
+func TestSprintf(t *testing.T) {
+	html, markdown := htmlFormatter{}, markdownFormatter{}
+	tests := []struct {
+		f      Formatter
+		format string
+		args   []interface{}
+		want   string
+	}{
+		{html, "<b>%s</b> & co", []interface{}{"x<y"}, "&lt;b&gt;x&lt;y&lt;/b&gt; &amp; co"},
+		{markdown, "Вопрос #%d: %s.", []interface{}{12, "a_b (c)"}, `Вопрос \#12: a\_b \(c\)\.`},
+		{html, "%s", []interface{}{Markup("<i>x</i>")}, "<i>x</i>"},
+		{markdown, "*%s*", []interface{}{Markup("*x*")}, `\**x*\*`},
+		{markdown, "%d%%", []interface{}{5}, "5%"},
+		{markdown, "%5.2f", []interface{}{3.14159}, ` 3\.14`},
+		{html, "%[2]s %[1]s %s", []interface{}{"a", "b"}, "b a b"},
+		{markdown, "%s и %s", []interface{}{"x"}, `x и %\!s\(MISSING\)`},
+		{markdown, "100%", nil, "100%"},
+		{html, "%q", []interface{}{"<"}, `"&lt;"`},
+	}
+	for _, tt := range tests {
+		if got := sprintf(tt.f, tt.format, tt.args...); got != tt.want {
+			t.Errorf("sprintf(%T, %q) = %q, ожидалось %q", tt.f, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	html, markdown := htmlFormatter{}, markdownFormatter{}
+	tests := []struct {
+		f    Formatter
+		in   string
+		want string
+	}{
+		{html, `a < b && c > "d"`, `a &lt; b &amp;&amp; c &gt; "d"`},
+		{markdown, markdownSpecial, `\_\*\[\]\(\)\~\` + "`" + `\>\#\+\-\=\|\{\}\.\!\\`},
+		{markdown, "Привет, мир", "Привет, мир"},
+	}
+	for _, tt := range tests {
+		got := tt.f.Escape(tt.in)
+		if got != tt.want {
+			t.Errorf("%T.Escape(%q) = %q, ожидалось %q", tt.f, tt.in, got, tt.want)
+		}
+		// Strip возвращает исходный текст
+		if back := tt.f.Strip(got); back != tt.in {
+			t.Errorf("%T.Strip(%q) = %q, ожидалось %q", tt.f, got, back, tt.in)
+		}
+	}
+
+	if got, want := markdown.Code("a`b\\c_d"), "`a\\`b\\\\c_d`"; got != want {
+		t.Errorf("Code = %q, ожидалось %q", got, want)
+	}
+	if got, want := markdown.Mention(5, "a_b"), `[a\_b](tg://user?id=5)`; got != want {
+		t.Errorf("Mention = %q, ожидалось %q", got, want)
+	}
+}
+
+func TestContent(t *testing.T) {
+	text := "Вызов `f(x)` падает:\n```go\nfmt.Println(a<b)\n```\nпочему?"
+	tests := []struct {
+		f    Formatter
+		want string
+	}{
+		{htmlFormatter{}, "Вызов <code>f(x)</code> падает:\n<pre>fmt.Println(a&lt;b)</pre>\nпочему?"},
+		{markdownFormatter{}, "Вызов `f(x)` падает:\n```\nfmt.Println(a<b)\n```\nпочему?"},
+	}
+	for _, tt := range tests {
+		if got := string(content(tt.f, text)); got != tt.want {
+			t.Errorf("content(%T) = %q, ожидалось %q", tt.f, got, tt.want)
+		}
+	}
+}
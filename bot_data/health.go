@@ -0,0 +1,31 @@
+package bot_data
+
+import (
+	"context"
+	"time"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// Available сообщает, что база данных доступна. Пока её нет, бот не выполняет
+// команды, а отвечает, что сервис временно недоступен.
+func (b *Bot) Available() bool {
+	return b.dtbase.Available()
+}
+
+// MonitorDB следит за базой данных и возвращает бота к работе, когда она снова доступна.
+func (b *Bot) MonitorDB(ctx context.Context, interval time.Duration) {
+	b.dtbase.Monitor(ctx, interval)
+}
+
+// UnavailableText - ответ, пока база недоступна. Настройки пользователя хранятся
+// в базе, поэтому язык берётся из клиента Telegram.
+func (b *Bot) UnavailableText(u *tgbotapi.User) string {
+	locale := defaultLocale
+	if u != nil {
+		if _, ok := catalog[u.LanguageCode]; ok {
+			locale = u.LanguageCode
+		}
+	}
+	return tr(locale, "service_unavailable")
+}
@@ -0,0 +1,481 @@
+package bot_data
+
+import "fmt"
+
+// defaultLocale - язык, который используется, пока пользователь не выбрал другой
+const defaultLocale = "ru"
+
+// locales - поддерживаемые языки в порядке показа в настройках
+var locales = []string{"ru", "en"}
+
+// catalog содержит все тексты, которые бот отправляет пользователям.
+var catalog = map[string]map[string]string{
+	"ru": {
+		"unknown_command":     "я не знаю такой команды :(",
+		"not_registered":      "Сначала зарегистрируйтесь с помощью команды /start",
+		"user_exists":         "Пользователь уже существует",
+		"registered":          "Успешная регистрация",
+		"error_retry":         "Ошибка. Попробуйте еще раз.",
+		"service_unavailable": "Сервис временно недоступен. Попробуйте позже.",
+		"banned":              "Вы заблокированы администратором.",
+		"user_not_found":      "Такого пользователя не существует",
+		"status_not_found":    "Статуса %d не существует",
+		"bad_arguments":       "Неправильно переданы аргументы",
+		"question_added":      "Вопрос добавлен успешно. Ожидайте ответа от пользователей",
+		"question_not_found":  "Такого вопроса не существует",
+		"answer_not_found":    "Такого ответа не существует",
+		"bad_question_id":     "Ошибка в введении номера вопроса",
+		"bad_answer_id":       "Ошибка в введении номера ответа",
+		"question_liked":      "Вы уже ставили лайк этому вопросу",
+		"answer_liked":        "Вы уже ставили лайк этому ответу",
+		"like_added":          "Лайк добавлен успешно.",
+		"answer_added":        "Ответ добавлен успешно. Ожидайте лайков)",
+		"no_questions_by_tag": "Не найдено ни одного вопроса по тегу",
+		"no_questions":        "Не найдено ни одного вопроса",
+		"no_answers":          "Не найдено ни одного ответа",
+		"question_entry":      "Вопрос от пользователя %s создан %s номер вопроса %d\n%s\nКоличество лайков: %d\n\n",
+		"answer_entry":        "Ответ от пользователя %s создан %s номер ответа %d\n%s\nКоличество лайков: %d\nСтатус пользователя: %s\n\n",
+		"questions_title":     "Вопросы по тегу %s\n\n",
+		"my_questions_title":  "Ваши вопросы\n\n",
+		"answers_title":       "Ответы на вопрос #%d\n\n",
+		"attachment_question": "Вложение к вопросу #%d",
+		"attachment_answer":   "Вложение к ответу #%d",
+
+		"help_header":      "Команды для работы с ботом:",
+		"usage":            "%s\nИспользование: %s - %s",
+		"args_missing":     "Не переданы аргументы",
+		"args_not_enough":  "Недостаточно аргументов",
+		"args_too_many":    "Слишком много аргументов",
+		"args_not_number":  "Аргумент \"%s\" должен быть числом",
+		"quote_not_closed": "Не закрыта кавычка",
+		"question_empty":   "Текст вопроса пустой",
+		"tags_required":    "Укажите хотя бы один тег",
+		"tag_too_long":     "Тег \"%s\" длиннее %d символов",
+
+		"usage.start":            "/start",
+		"desc.start":             "зарегистрироваться",
+		"usage.ask":              "/ask <вопрос>~<теги>",
+		"desc.ask":               "задать вопрос. Теги можно указать и через #хэштеги в тексте. Команду можно написать в подписи к фото или документу",
+		"usage.answer":           "/answer <номер вопроса>~<ответ>",
+		"desc.answer":            "ответить на вопрос, в том числе подписью к фото или документу",
+		"usage.get_answers":      "/get_answers <номер вопроса>",
+		"desc.get_answers":       "получить все текущие ответы на вопрос",
+		"usage.questions":        "/questions <тег>",
+		"desc.questions":         "получить 10 самых залайканных вопросов по тегу",
+		"usage.my_questions":     "/my_questions",
+		"desc.my_questions":      "получить все заданные Вами вопросы",
+		"usage.like_question":    "/like_question <номер вопроса>",
+		"desc.like_question":     "поставить лайк вопросу",
+		"usage.like_answer":      "/like_answer <номер ответа>",
+		"desc.like_answer":       "поставить лайк ответу",
+		"usage.close":            "/close <номер вопроса>",
+		"desc.close":             "закрыть свой вопрос",
+		"usage.export":           "/export <csv|json|md|html> <questions <тег>|my_questions|answers <номер вопроса>>",
+		"desc.export":            "выгрузить список в файл",
+		"usage.subscribe":        "/subscribe <тег>",
+		"desc.subscribe":         "подписаться на тег для дайджеста",
+		"usage.unsubscribe":      "/unsubscribe <тег>",
+		"desc.unsubscribe":       "отписаться от тега",
+		"usage.digest":           "/digest <daily|weekly|off>",
+		"desc.digest":            "частота дайджеста",
+		"usage.settings":         "/settings [<параметр> <значение>]",
+		"desc.settings":          "настройки: язык, часовой пояс, файлы, дайджест, уведомления",
+		"usage.chat_mode":        "/chat_mode [group|private]",
+		"desc.chat_mode":         "в группе: отвечать в общий чат или в личные сообщения",
+		"usage.community":        "/community",
+		"desc.community":         "ваши сообщества и активное из них",
+		"usage.community_create": "/community_create <название>",
+		"desc.community_create":  "создать сообщество. В группе оно привязывается к чату",
+		"usage.community_join":   "/community_join <код приглашения>",
+		"desc.community_join":    "вступить в сообщество",
+		"usage.community_switch": "/community_switch <номер сообщества>",
+		"desc.community_switch":  "сделать сообщество активным, 0 - общее пространство",
+		"usage.community_leave":  "/community_leave <номер сообщества>",
+		"desc.community_leave":   "выйти из сообщества",
+		"usage.tags":             "/tags [name|questions|unanswered] [страница]",
+		"desc.tags":              "список тегов",
+		"usage.tag":              "/tag <тег>",
+		"desc.tag":               "описание тега",
+		"usage.tag_description":  "/tag_description <тег>~<описание>",
+		"desc.tag_description":   "изменить описание тега (для модераторов)",
+		"usage.merge_tags":       "/merge_tags <тег> <основной тег>",
+		"desc.merge_tags":        "объединить теги (для администраторов)",
+		"usage.tag_synonym":      "/tag_synonym <синоним> <тег>",
+		"desc.tag_synonym":       "добавить синоним тега (для администраторов)",
+		"usage.webhooks":         "/webhooks",
+		"desc.webhooks":          "исходящие вебхуки (для администраторов)",
+		"usage.webhook_add":      "/webhook_add <адрес> [события]",
+		"desc.webhook_add":       "добавить исходящий вебхук активного сообщества (для администраторов, в личных сообщениях)",
+		"usage.webhook_remove":   "/webhook_remove <номер вебхука>",
+		"desc.webhook_remove":    "отключить исходящий вебхук (для администраторов)",
+		"usage.audit":            "/audit [номер пользователя|действие]",
+		"desc.audit":             "журнал действий (для администраторов)",
+		"usage.recount":          "/recount",
+		"desc.recount":           "пересчитать счётчики лайков и ответов (для администраторов)",
+		"usage.help":             "/help",
+		"desc.help":              "показать все возможные команды",
+
+		"duplicates_header":  "Похоже, такой вопрос уже задавали:\n\n",
+		"duplicate_entry":    "#%d %s\nКоличество ответов: %d\n\n",
+		"duplicates_footer":  "Откройте один из них или опубликуйте свой вопрос всё равно.",
+		"button_open":        "Открыть #%d",
+		"button_post_anyway": "Опубликовать всё равно",
+		"button_cancel":      "Отмена",
+		"no_pending":         "Нет вопроса, ожидающего публикации. Задайте его заново через /ask",
+		"ask_cancelled":      "Публикация вопроса отменена",
+
+		"subscribed":              "Вы подписались на тег %s. Включите дайджест командой /digest daily или /digest weekly",
+		"already_subscribed":      "Вы уже подписаны на тег %s",
+		"not_subscribed":          "Вы не подписаны на этот тег",
+		"unsubscribed":            "Вы отписались от тега %s",
+		"digest_bad_frequency":    "Укажите частоту дайджеста: daily, weekly или off",
+		"digest_off":              "Дайджест отключён",
+		"digest_on":               "Дайджест включён: %s",
+		"digest_title":            "Ваш дайджест\n\n",
+		"digest_new_questions":    "Новые вопросы по тегу %s:\n",
+		"digest_question_entry":   "#%d %s (лайков: %d)\n",
+		"digest_unanswered":       "Вопросы без ответов, на которые Вы можете ответить:\n",
+		"digest_entry":            "#%d %s\n",
+		"digest_activity":         "Новая активность в Ваших вопросах:\n",
+		"digest_activity_entry":   "#%d %s (новых ответов: %d)\n",
+		"admins_only":             "Команда доступна только администраторам",
+		"moderators_only":         "Команда доступна только модераторам",
+		"close_not_owner":         "Закрыть вопрос может только его автор или модератор",
+		"question_already_closed": "Вопрос уже закрыт",
+		"question_closed":         "Вопрос #%d закрыт",
+		"webhook_bad_url":         "Адрес вебхука должен начинаться с http:// или https://",
+		"webhook_bad_event":       "Неизвестное событие. Доступные события: %s",
+		"webhook_added":           "Вебхук #%d добавлен. Секрет для проверки подписи:\n%s",
+		"webhook_not_found":       "Активного вебхука с таким номером нет",
+		"webhook_removed":         "Вебхук #%s отключён",
+		"webhook_entry":           "#%d %s\nсообщество: %s, события: %s, доставлено: %d, не доставлено: %d\n",
+		"webhook_private_only":    "Добавляйте вебхуки в личных сообщениях с ботом: в ответе будет секрет подписи",
+		"webhooks_empty":          "Активных вебхуков нет",
+		"audit_empty":             "Записей в журнале нет",
+		"audit_header":            "Журнал действий, последние %d из %d:\n",
+		"audit_entry":             "#%d %s пользователь %d: %s %s\n",
+		"counters_fixed":          "Счётчики пересчитаны. Исправлено вопросов: %d, ответов: %d",
+		"tag_not_found":           "Такого тега не существует",
+		"tags_merged":             "Тег %s объединён с тегом %s",
+		"tag_exists_use_merge":    "Тег %s уже существует, используйте /merge_tags",
+		"synonym_added":           "Синоним %s добавлен для тега %s",
+		"tags_bad_order":          "Сортировка может быть: name, questions, unanswered",
+		"tags_bad_page":           "Номер страницы должен быть положительным",
+		"tags_entry":              "%s - вопросов: %d, без ответа: %d\n",
+		"tags_empty":              "Не найдено ни одного тега",
+		"tags_page":               "\nСтраница %d из %d",
+		"tags_next":               ". Следующая: /tags %s %d",
+		"tag_info":                "Тег %s\nВопросов: %d, без ответа: %d\n\n",
+		"tag_no_description":      "Описание пока не добавлено",
+		"tag_description_update":  "Описание тега %s обновлено",
+
+		"export_bad_format":    "Формат может быть: csv, json, md, html",
+		"export_need_tag":      "Укажите тег: /export %s questions <тег>",
+		"export_need_id":       "Укажите номер вопроса: /export %s answers <номер вопроса>",
+		"export_bad_scope":     "Область выгрузки может быть: questions <тег>, my_questions, answers <номер вопроса>",
+		"export_sent":          "Файл отправлен",
+		"notify_answer":        "На Ваш вопрос #%d ответил пользователь %s:\n%s",
+		"notify_question_like": "Пользователь %s поставил лайк Вашему вопросу #%d",
+		"notify_answer_like":   "Пользователь %s поставил лайк Вашему ответу #%d",
+
+		"settings_title":         "Ваши настройки:\n",
+		"settings_locale":        "Язык",
+		"settings_timezone":      "Часовой пояс",
+		"settings_export":        "Файлы к спискам",
+		"settings_format":        "Формат файлов",
+		"settings_digest":        "Дайджест",
+		"settings_notify_answer": "Уведомления об ответах",
+		"settings_notify_likes":  "Уведомления о лайках",
+		"settings_line":          "%s: %s\n",
+		"settings_hint":          "\nИзмените настройку кнопками ниже или командой /settings <параметр> <значение>. Параметры: locale, timezone, export, format, digest, notify_answers, notify_likes",
+		"settings_on":            "вкл",
+		"settings_off":           "выкл",
+		"settings_saved":         "Настройка сохранена",
+		"settings_bad_key":       "Такой настройки нет. Параметры: locale, timezone, export, format, digest, notify_answers, notify_likes",
+		"settings_bad_value":     "Недопустимое значение настройки",
+
+		"chat_mode_group_only": "Команда работает только в группах",
+		"chat_mode_current":    "Ответы на команды отправляются: %s",
+		"chat_mode_set":        "Теперь ответы на команды отправляются: %s",
+		"chat_mode_bad":        "Режим может быть: group или private",
+		"chat_admins_only":     "Команда доступна только администраторам группы",
+		"private_unavailable":  "Не удалось написать Вам в личные сообщения. Откройте чат с ботом и нажмите /start",
+
+		"community_bad_name":        "Название сообщества должно быть от 1 до %d символов",
+		"community_chat_bound":      "К этому чату уже привязано сообщество",
+		"community_created":         "Сообщество «%s» создано, номер %d. Код приглашения: %s",
+		"community_bad_code":        "Неверный код приглашения",
+		"community_joined":          "Вы вступили в сообщество «%s», теперь оно активно",
+		"community_bad_id":          "Номер сообщества должен быть неотрицательным числом",
+		"community_not_member":      "Вы не состоите в этом сообществе",
+		"community_switched":        "Активное сообщество: %d",
+		"community_switched_global": "Активно общее пространство",
+		"community_left":            "Вы вышли из сообщества %d",
+		"communities_header":        "Ваши сообщества:\n",
+		"community_global":          "общее пространство",
+		"community_entry":           "%d - %s",
+		"community_invite":          " (код: %s)",
+		"communities_hint":          "\nСменить активное: /community_switch <номер>",
+		"communities_group_hint":    "\nВ этом чате команды выполняются в сообществе, отмеченном галочкой. Коды приглашения и смена активного сообщества - в личных сообщениях с ботом",
+	},
+	"en": {
+		"unknown_command":     "I don't know this command :(",
+		"not_registered":      "Please register first with the /start command",
+		"user_exists":         "User already exists",
+		"registered":          "Registration successful",
+		"error_retry":         "Error. Please try again.",
+		"service_unavailable": "The service is temporarily unavailable. Please try again later.",
+		"banned":              "You have been banned by an administrator.",
+		"user_not_found":      "No such user",
+		"status_not_found":    "Status %d does not exist",
+		"bad_arguments":       "Invalid arguments",
+		"question_added":      "Question added. Wait for answers from other users",
+		"question_not_found":  "No such question",
+		"answer_not_found":    "No such answer",
+		"bad_question_id":     "Invalid question number",
+		"bad_answer_id":       "Invalid answer number",
+		"question_liked":      "You have already liked this question",
+		"answer_liked":        "You have already liked this answer",
+		"like_added":          "Like added.",
+		"answer_added":        "Answer added. Wait for likes)",
+		"no_questions_by_tag": "No questions found for the tag",
+		"no_questions":        "No questions found",
+		"no_answers":          "No answers found",
+		"question_entry":      "Question from %s created %s question number %d\n%s\nLikes: %d\n\n",
+		"answer_entry":        "Answer from %s created %s answer number %d\n%s\nLikes: %d\nUser status: %s\n\n",
+		"questions_title":     "Questions for the tag %s\n\n",
+		"my_questions_title":  "Your questions\n\n",
+		"answers_title":       "Answers to question #%d\n\n",
+		"attachment_question": "Attachment to question #%d",
+		"attachment_answer":   "Attachment to answer #%d",
+
+		"help_header":      "Bot commands:",
+		"usage":            "%s\nUsage: %s - %s",
+		"args_missing":     "No arguments given",
+		"args_not_enough":  "Not enough arguments",
+		"args_too_many":    "Too many arguments",
+		"args_not_number":  "Argument \"%s\" must be a number",
+		"quote_not_closed": "Unclosed quote",
+		"question_empty":   "Question text is empty",
+		"tags_required":    "Specify at least one tag",
+		"tag_too_long":     "Tag \"%s\" is longer than %d characters",
+
+		"usage.start":            "/start",
+		"desc.start":             "register",
+		"usage.ask":              "/ask <question>~<tags>",
+		"desc.ask":               "ask a question. Tags can also be given as #hashtags in the text. The command can be a caption of a photo or document",
+		"usage.answer":           "/answer <question number>~<answer>",
+		"desc.answer":            "answer a question, also as a caption of a photo or document",
+		"usage.get_answers":      "/get_answers <question number>",
+		"desc.get_answers":       "get all answers to a question",
+		"usage.questions":        "/questions <tag>",
+		"desc.questions":         "get the 10 most liked questions for a tag",
+		"usage.my_questions":     "/my_questions",
+		"desc.my_questions":      "get all questions you asked",
+		"usage.like_question":    "/like_question <question number>",
+		"desc.like_question":     "like a question",
+		"usage.like_answer":      "/like_answer <answer number>",
+		"desc.like_answer":       "like an answer",
+		"usage.close":            "/close <question number>",
+		"desc.close":             "close your question",
+		"usage.export":           "/export <csv|json|md|html> <questions <tag>|my_questions|answers <question number>>",
+		"desc.export":            "export a listing to a file",
+		"usage.subscribe":        "/subscribe <tag>",
+		"desc.subscribe":         "subscribe to a tag for the digest",
+		"usage.unsubscribe":      "/unsubscribe <tag>",
+		"desc.unsubscribe":       "unsubscribe from a tag",
+		"usage.digest":           "/digest <daily|weekly|off>",
+		"desc.digest":            "digest frequency",
+		"usage.settings":         "/settings [<key> <value>]",
+		"desc.settings":          "settings: language, time zone, files, digest, notifications",
+		"usage.chat_mode":        "/chat_mode [group|private]",
+		"desc.chat_mode":         "in a group: reply in the group or in private messages",
+		"usage.community":        "/community",
+		"desc.community":         "your communities and the active one",
+		"usage.community_create": "/community_create <name>",
+		"desc.community_create":  "create a community. In a group it is bound to the chat",
+		"usage.community_join":   "/community_join <invite code>",
+		"desc.community_join":    "join a community",
+		"usage.community_switch": "/community_switch <community number>",
+		"desc.community_switch":  "make a community active, 0 is the shared space",
+		"usage.community_leave":  "/community_leave <community number>",
+		"desc.community_leave":   "leave a community",
+		"usage.tags":             "/tags [name|questions|unanswered] [page]",
+		"desc.tags":              "list tags",
+		"usage.tag":              "/tag <tag>",
+		"desc.tag":               "tag description",
+		"usage.tag_description":  "/tag_description <tag>~<description>",
+		"desc.tag_description":   "change a tag description (moderators)",
+		"usage.merge_tags":       "/merge_tags <tag> <main tag>",
+		"desc.merge_tags":        "merge tags (administrators)",
+		"usage.tag_synonym":      "/tag_synonym <synonym> <tag>",
+		"desc.tag_synonym":       "add a tag synonym (administrators)",
+		"usage.webhooks":         "/webhooks",
+		"desc.webhooks":          "outgoing webhooks (administrators)",
+		"usage.webhook_add":      "/webhook_add <url> [events]",
+		"desc.webhook_add":       "add an outgoing webhook for the active community (administrators, private chat)",
+		"usage.webhook_remove":   "/webhook_remove <webhook number>",
+		"desc.webhook_remove":    "disable an outgoing webhook (administrators)",
+		"usage.audit":            "/audit [user id|action]",
+		"desc.audit":             "action log (administrators)",
+		"usage.recount":          "/recount",
+		"desc.recount":           "recount like and answer counters (administrators)",
+		"usage.help":             "/help",
+		"desc.help":              "show all commands",
+
+		"duplicates_header":  "This question seems to have been asked already:\n\n",
+		"duplicate_entry":    "#%d %s\nAnswers: %d\n\n",
+		"duplicates_footer":  "Open one of them or post your question anyway.",
+		"button_open":        "Open #%d",
+		"button_post_anyway": "Post anyway",
+		"button_cancel":      "Cancel",
+		"no_pending":         "No question is waiting to be posted. Ask it again with /ask",
+		"ask_cancelled":      "Question was not posted",
+
+		"subscribed":              "You subscribed to the tag %s. Turn on the digest with /digest daily or /digest weekly",
+		"already_subscribed":      "You are already subscribed to the tag %s",
+		"not_subscribed":          "You are not subscribed to this tag",
+		"unsubscribed":            "You unsubscribed from the tag %s",
+		"digest_bad_frequency":    "Digest frequency must be daily, weekly or off",
+		"digest_off":              "Digest turned off",
+		"digest_on":               "Digest turned on: %s",
+		"digest_title":            "Your digest\n\n",
+		"digest_new_questions":    "New questions for the tag %s:\n",
+		"digest_question_entry":   "#%d %s (likes: %d)\n",
+		"digest_unanswered":       "Unanswered questions you could help with:\n",
+		"digest_entry":            "#%d %s\n",
+		"digest_activity":         "New activity on your questions:\n",
+		"digest_activity_entry":   "#%d %s (new answers: %d)\n",
+		"admins_only":             "This command is for administrators only",
+		"moderators_only":         "This command is for moderators only",
+		"close_not_owner":         "Only the author or a moderator can close a question",
+		"question_already_closed": "The question is already closed",
+		"question_closed":         "Question #%d is closed",
+		"webhook_bad_url":         "The webhook URL must start with http:// or https://",
+		"webhook_bad_event":       "Unknown event. Available events: %s",
+		"webhook_added":           "Webhook #%d added. Signing secret:\n%s",
+		"webhook_not_found":       "No active webhook with this number",
+		"webhook_removed":         "Webhook #%s disabled",
+		"webhook_entry":           "#%d %s\ncommunity: %s, events: %s, delivered: %d, not delivered: %d\n",
+		"webhook_private_only":    "Add webhooks in a private chat with the bot: the reply contains the signing secret",
+		"webhooks_empty":          "No active webhooks",
+		"audit_empty":             "The log is empty",
+		"audit_header":            "Action log, latest %d of %d:\n",
+		"audit_entry":             "#%d %s user %d: %s %s\n",
+		"counters_fixed":          "Counters recounted. Fixed questions: %d, answers: %d",
+		"tag_not_found":           "No such tag",
+		"tags_merged":             "Tag %s merged into %s",
+		"tag_exists_use_merge":    "Tag %s already exists, use /merge_tags",
+		"synonym_added":           "Synonym %s added for the tag %s",
+		"tags_bad_order":          "Sort order must be name, questions or unanswered",
+		"tags_bad_page":           "Page number must be positive",
+		"tags_entry":              "%s - questions: %d, unanswered: %d\n",
+		"tags_empty":              "No tags found",
+		"tags_page":               "\nPage %d of %d",
+		"tags_next":               ". Next: /tags %s %d",
+		"tag_info":                "Tag %s\nQuestions: %d, unanswered: %d\n\n",
+		"tag_no_description":      "No description yet",
+		"tag_description_update":  "Description of the tag %s updated",
+
+		"export_bad_format":    "Format must be csv, json, md or html",
+		"export_need_tag":      "Specify a tag: /export %s questions <tag>",
+		"export_need_id":       "Specify a question number: /export %s answers <question number>",
+		"export_bad_scope":     "Export scope must be questions <tag>, my_questions or answers <question number>",
+		"export_sent":          "File sent",
+		"notify_answer":        "%[2]s answered your question #%[1]d:\n%[3]s",
+		"notify_question_like": "%s liked your question #%d",
+		"notify_answer_like":   "%s liked your answer #%d",
+
+		"settings_title":         "Your settings:\n",
+		"settings_locale":        "Language",
+		"settings_timezone":      "Time zone",
+		"settings_export":        "Files with listings",
+		"settings_format":        "File format",
+		"settings_digest":        "Digest",
+		"settings_notify_answer": "Answer notifications",
+		"settings_notify_likes":  "Like notifications",
+		"settings_line":          "%s: %s\n",
+		"settings_hint":          "\nChange a setting with the buttons below or with /settings <key> <value>. Keys: locale, timezone, export, format, digest, notify_answers, notify_likes",
+		"settings_on":            "on",
+		"settings_off":           "off",
+		"settings_saved":         "Setting saved",
+		"settings_bad_key":       "No such setting. Keys: locale, timezone, export, format, digest, notify_answers, notify_likes",
+		"settings_bad_value":     "Invalid setting value",
+
+		"chat_mode_group_only": "This command works in groups only",
+		"chat_mode_current":    "Command replies are sent to: %s",
+		"chat_mode_set":        "Command replies are now sent to: %s",
+		"chat_mode_bad":        "Mode must be group or private",
+		"chat_admins_only":     "This command is for group administrators only",
+		"private_unavailable":  "Could not send you a private message. Open a chat with the bot and press /start",
+
+		"community_bad_name":        "Community name must be 1 to %d characters long",
+		"community_chat_bound":      "A community is already bound to this chat",
+		"community_created":         "Community \"%s\" created, number %d. Invite code: %s",
+		"community_bad_code":        "Invalid invite code",
+		"community_joined":          "You joined \"%s\", it is now active",
+		"community_bad_id":          "Community number must be a non-negative number",
+		"community_not_member":      "You are not a member of this community",
+		"community_switched":        "Active community: %d",
+		"community_switched_global": "The shared space is active",
+		"community_left":            "You left community %d",
+		"communities_header":        "Your communities:\n",
+		"community_global":          "shared space",
+		"community_entry":           "%d - %s",
+		"community_invite":          " (code: %s)",
+		"communities_hint":          "\nSwitch the active one: /community_switch <number>",
+		"communities_group_hint":    "\nCommands in this chat run in the checked community. Invite codes and switching the active community are available in a private chat with the bot",
+	},
+}
+
+// tr возвращает текст сообщения key на языке locale. Если перевода нет,
+// используется язык по умолчанию, а затем сам ключ.
+func tr(locale, key string, args ...interface{}) string {
+	text, ok := catalog[locale][key]
+	if !ok {
+		text, ok = catalog[defaultLocale][key]
+	}
+	if !ok {
+		text = key
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// T возвращает текст сообщения на языке пользователя.
+func (b *Bot) T(userID int64, key string, args ...interface{}) string {
+	return tr(b.settings(userID).Locale, key, args...)
+}
+
+// localizer - ошибка, текст которой зависит от языка пользователя.
+type localizer interface {
+	Localize(locale string) string
+}
+
+// i18nError - ошибка с текстом из каталога сообщений.
+type i18nError struct {
+	key  string
+	args []interface{}
+}
+
+func newError(key string, args ...interface{}) i18nError {
+	return i18nError{key: key, args: args}
+}
+
+func (e i18nError) Error() string {
+	return e.Localize(defaultLocale)
+}
+
+func (e i18nError) Localize(locale string) string {
+	return tr(locale, e.key, e.args...)
+}
+
+// ErrorText возвращает текст ошибки на языке пользователя.
+func (b *Bot) ErrorText(userID int64, err error) string {
+	if l, ok := err.(localizer); ok {
+		return l.Localize(b.settings(userID).Locale)
+	}
+	return err.Error()
+}
@@ -0,0 +1,616 @@
+package bot_data
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Импорт переносит в бота вопросы и ответы из других систем: источник читается
+// в ImportData, а Import записывает его в базу. Каждая перенесённая запись
+// запоминается в importmap под своим номером в источнике, поэтому повторный
+// импорт того же источника обновляет перенесённые записи, а не дублирует их.
+
+// Виды записей в importmap
+const (
+	importUser     = "user"
+	importQuestion = "question"
+	importAnswer   = "answer"
+)
+
+// importTables - таблица и ключ, по которым проверяется, что запись бота,
+// сохранённая в importmap, ещё существует
+var importTables = map[string][2]string{
+	importUser:     {"public.users", "user_id"},
+	importQuestion: {"public.questions", "question_id"},
+	importAnswer:   {"public.answers", "answer_id"},
+}
+
+// ImportUser - автор вопросов и ответов в источнике.
+type ImportUser struct {
+	// ID - номер или имя пользователя в источнике
+	ID       string
+	Username string
+	// Match разрешает связать автора с пользователем бота с тем же именем:
+	// так делается для выгрузок самого бота, где Username - имя в Telegram
+	Match     bool
+	CreatedAt time.Time
+}
+
+// ImportTag - тег с описанием. Описание записывается, только если у тега в боте его ещё нет.
+type ImportTag struct {
+	Name        string
+	Description string
+}
+
+type ImportQuestion struct {
+	ID        string
+	UserID    string
+	Text      string
+	Tags      []string
+	CreatedAt time.Time
+	// Closed - закрыт ли вопрос в источнике. nil - в источнике этого нет: новый
+	// вопрос переносится открытым, а у перенесённого раньше состояние не меняется
+	Closed *bool
+	// Likes - голоса за вопрос в источнике
+	Likes int
+}
+
+type ImportAnswer struct {
+	ID         string
+	QuestionID string
+	UserID     string
+	Text       string
+	CreatedAt  time.Time
+	Likes      int
+}
+
+// ImportData - содержимое источника. Авторы, которых нет в Users, переносятся
+// с именем, равным их номеру в источнике.
+type ImportData struct {
+	Users     []ImportUser
+	Tags      []ImportTag
+	Questions []ImportQuestion
+	Answers   []ImportAnswer
+}
+
+// ImportResult - итог импорта.
+type ImportResult struct {
+	UsersCreated     int `json:"users_created"`
+	TagsCreated      int `json:"tags_created"`
+	QuestionsCreated int `json:"questions_created"`
+	QuestionsUpdated int `json:"questions_updated"`
+	AnswersCreated   int `json:"answers_created"`
+	AnswersUpdated   int `json:"answers_updated"`
+	// Skipped - записи без текста и ответы на вопросы, которых нет ни в источнике,
+	// ни в прошлых импортах
+	Skipped int `json:"skipped"`
+}
+
+// Import переносит data в бота от имени actorID. source - название источника:
+// повторный импорт под тем же названием обновляет ранее перенесённые записи.
+// Вопросы попадают в сообщество community (0 - общее пространство). Импорт
+// выполняется одной транзакцией и не рассылает уведомлений и вебхуков.
+func (b *Bot) Import(actorID int64, source string, community int64, data ImportData) (ImportResult, error) {
+	var result ImportResult
+	if source == "" {
+		return result, fmt.Errorf("не указано название источника")
+	}
+	err := b.inTx(func(tx *sql.Tx) error {
+		if community != 0 {
+			var exists bool
+			if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM public.communities WHERE community_id = $1);", community).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return fmt.Errorf("сообщество %d не найдено", community)
+			}
+		}
+		im := &importer{
+			b:           b,
+			tx:          tx,
+			source:      source,
+			community:   communityArg(community),
+			users:       make(map[string]ImportUser, len(data.Users)),
+			userIDs:     make(map[string]int64),
+			questionIDs: make(map[string]int64),
+			tagIDs:      make(map[string]int64),
+			result:      &result,
+		}
+		for _, u := range data.Users {
+			im.users[u.ID] = u
+		}
+		for _, t := range data.Tags {
+			if err := im.tagDescription(t); err != nil {
+				return fmt.Errorf("тег %s: %v", t.Name, err)
+			}
+		}
+		for _, q := range data.Questions {
+			if err := im.question(q); err != nil {
+				return fmt.Errorf("вопрос %s: %v", q.ID, err)
+			}
+		}
+		for _, a := range data.Answers {
+			if err := im.answer(a); err != nil {
+				return fmt.Errorf("ответ %s: %v", a.ID, err)
+			}
+		}
+		return audit(tx, actorID, AuditImport, auditTargetImport, source, nil, result)
+	})
+	if err != nil {
+		return ImportResult{}, err
+	}
+	b.invalidateListings()
+	b.cache.answers.Purge()
+	return result, nil
+}
+
+// importer хранит состояние одного импорта.
+type importer struct {
+	b         *Bot
+	tx        *sql.Tx
+	source    string
+	community interface{}
+	users     map[string]ImportUser
+	// номера записей бота по номерам в источнике
+	userIDs     map[string]int64
+	questionIDs map[string]int64
+	// tagIDs - номера тегов по названию в источнике, 0 для отброшенных тегов
+	tagIDs map[string]int64
+	result *ImportResult
+}
+
+// mapped возвращает запись бота, в которую уже перенесена запись источника.
+func (im *importer) mapped(kind, id string) (int64, bool, error) {
+	table := importTables[kind]
+	query := `
+		SELECT m.local_id
+		FROM public.importmap m
+		WHERE m.source = $1 AND m.kind = $2 AND m.external_id = $3
+		  AND EXISTS (SELECT 1 FROM ` + table[0] + ` WHERE ` + table[1] + ` = m.local_id);
+	`
+	var local int64
+	err := im.tx.QueryRow(query, im.source, kind, id).Scan(&local)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return local, err == nil, err
+}
+
+func (im *importer) remember(kind, id string, local int64) error {
+	query := `
+		INSERT INTO public.importmap (source, kind, external_id, local_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (source, kind, external_id) DO UPDATE
+		SET local_id = EXCLUDED.local_id;
+	`
+	_, err := im.tx.Exec(query, im.source, kind, id, local)
+	return err
+}
+
+// user возвращает пользователя бота для автора id, при необходимости создавая его.
+func (im *importer) user(id string) (int64, error) {
+	if local, ok := im.userIDs[id]; ok {
+		return local, nil
+	}
+	local, ok, err := im.mapped(importUser, id)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		u, known := im.users[id]
+		if !known {
+			u = ImportUser{ID: id, Username: id}
+		}
+		if u.Match && u.Username != "" {
+			// при совпадении имён предпочитаем настоящего пользователя Telegram
+			query := "SELECT user_id FROM public.users WHERE username = $1 ORDER BY user_id DESC LIMIT 1;"
+			err := im.tx.QueryRow(query, u.Username).Scan(&local)
+			if err != nil && err != sql.ErrNoRows {
+				return 0, err
+			}
+			ok = err == nil
+		}
+		if !ok {
+			if local, err = im.createUser(u); err != nil {
+				return 0, err
+			}
+			im.result.UsersCreated++
+		}
+		if err := im.remember(importUser, id, local); err != nil {
+			return 0, err
+		}
+	}
+	im.userIDs[id] = local
+	return local, nil
+}
+
+// createUser добавляет автора из источника. У него нет аккаунта Telegram, поэтому
+// ему выдаётся следующий отрицательный номер: Telegram таких пользователям не выдаёт.
+func (im *importer) createUser(u ImportUser) (int64, error) {
+	var id int64
+	if err := im.tx.QueryRow("SELECT COALESCE(MIN(user_id), 0) - 1 FROM public.users WHERE user_id < 0;").Scan(&id); err != nil {
+		return 0, err
+	}
+	query := `
+		INSERT INTO public.users (user_id, username, registration_date, question_count, answer_count, status_id)
+		VALUES ($1, $2, $3, 0, 0, 1);
+	`
+	_, err := im.tx.Exec(query, id, u.Username, importTime(u.CreatedAt))
+	return id, err
+}
+
+// tag возвращает номер тега с каноническим названием, создавая тег при необходимости.
+// Для пустых и слишком длинных тегов возвращается 0.
+func (im *importer) tag(name string) (int64, error) {
+	if id, ok := im.tagIDs[name]; ok {
+		return id, nil
+	}
+	var id int64
+	if tag := canonicalTagIn(im.tx, name); tag != "" {
+		res, err := im.tx.Exec("INSERT INTO public.tags (tag_name) VALUES ($1) ON CONFLICT (tag_name) DO NOTHING;", tag)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			im.result.TagsCreated++
+		}
+		if err := im.tx.QueryRow("SELECT tag_id FROM public.tags WHERE tag_name = $1;", tag).Scan(&id); err != nil {
+			return 0, err
+		}
+	}
+	im.tagIDs[name] = id
+	return id, nil
+}
+
+func (im *importer) tagDescription(t ImportTag) error {
+	id, err := im.tag(t.Name)
+	if err != nil || id == 0 || t.Description == "" {
+		return err
+	}
+	_, err = im.tx.Exec("UPDATE public.tags SET description = $2 WHERE tag_id = $1 AND description = '';", id, t.Description)
+	return err
+}
+
+func (im *importer) question(q ImportQuestion) error {
+	if strings.TrimSpace(q.Text) == "" {
+		im.result.Skipped++
+		return nil
+	}
+	userID, err := im.user(q.UserID)
+	if err != nil {
+		return err
+	}
+	local, ok, err := im.mapped(importQuestion, q.ID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		// лайки, поставленные уже в боте, сохраняются, как и закрытие вопроса,
+		// если источник не знает, закрыт ли он
+		query := `
+			UPDATE public.questions
+			SET question_text = $2, is_closed = COALESCE($3, is_closed),
+				like_count = like_count - imported_likes + $4, imported_likes = $4
+			WHERE question_id = $1 AND (question_text <> $2 OR is_closed <> COALESCE($3, is_closed) OR imported_likes <> $4);
+		`
+		res, err := im.tx.Exec(query, local, q.Text, q.Closed, q.Likes)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			im.result.QuestionsUpdated++
+		}
+	} else {
+		query := `
+			INSERT INTO public.questions (user_id, question_text, created_at, is_closed, community_id, like_count, imported_likes)
+			VALUES ($1, $2, $3, $4, $5, $6, $6)
+			RETURNING question_id;
+		`
+		closed := q.Closed != nil && *q.Closed
+		err := im.tx.QueryRow(query, userID, q.Text, importTime(q.CreatedAt), closed, im.community, q.Likes).Scan(&local)
+		if err != nil {
+			return err
+		}
+		if err := im.remember(importQuestion, q.ID, local); err != nil {
+			return err
+		}
+		im.result.QuestionsCreated++
+	}
+	im.questionIDs[q.ID] = local
+
+	for _, name := range q.Tags {
+		tagID, err := im.tag(name)
+		if err != nil {
+			return err
+		}
+		if tagID == 0 {
+			continue
+		}
+		if _, err := im.tx.Exec("INSERT INTO public.questiontags (question_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;", local, tagID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *importer) answer(a ImportAnswer) error {
+	questionID, ok := im.questionIDs[a.QuestionID]
+	if !ok {
+		var err error
+		if questionID, ok, err = im.mapped(importQuestion, a.QuestionID); err != nil {
+			return err
+		}
+	}
+	if !ok || strings.TrimSpace(a.Text) == "" {
+		im.result.Skipped++
+		return nil
+	}
+	userID, err := im.user(a.UserID)
+	if err != nil {
+		return err
+	}
+	local, ok, err := im.mapped(importAnswer, a.ID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		query := `
+			UPDATE public.answers
+			SET answer_text = $2, like_count = like_count - imported_likes + $3, imported_likes = $3
+			WHERE answer_id = $1 AND (answer_text <> $2 OR imported_likes <> $3);
+		`
+		res, err := im.tx.Exec(query, local, a.Text, a.Likes)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			im.result.AnswersUpdated++
+		}
+		return nil
+	}
+	query := `
+		INSERT INTO public.answers (question_id, user_id, answer_text, created_at, like_count, imported_likes)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING answer_id;
+	`
+	if err := im.tx.QueryRow(query, questionID, userID, a.Text, importTime(a.CreatedAt), a.Likes).Scan(&local); err != nil {
+		return err
+	}
+	im.result.AnswersCreated++
+	return im.remember(importAnswer, a.ID, local)
+}
+
+// importTime - время записи; если в источнике его нет, записи датируются моментом импорта.
+func importTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+// tableReaders читают таблицы в тех форматах, в которых их выгружает бот.
+var tableReaders = map[string]func(r io.Reader) (Table, error){
+	"csv":  readCSVTable,
+	"json": readJSONTable,
+}
+
+// ReadTableFile читает таблицу из файла, формат определяется по расширению.
+// Name таблицы - имя файла без расширения, как при выгрузке.
+func ReadTableFile(path string) (Table, error) {
+	ext := filepath.Ext(path)
+	read, ok := tableReaders[strings.ToLower(strings.TrimPrefix(ext, "."))]
+	if !ok {
+		return Table{}, fmt.Errorf("%s: неизвестный формат, поддерживаются csv и json", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return Table{}, err
+	}
+	defer f.Close()
+	t, err := read(f)
+	if err != nil {
+		return Table{}, fmt.Errorf("%s: %v", path, err)
+	}
+	t.Name = strings.TrimSuffix(filepath.Base(path), ext)
+	return t, nil
+}
+
+func readCSVTable(r io.Reader) (Table, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return Table{}, err
+	}
+	if len(records) == 0 {
+		return Table{}, fmt.Errorf("нет строки заголовка")
+	}
+	// Excel и некоторые выгрузки начинают файл с BOM
+	records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	return Table{Header: records[0], Rows: records[1:]}, nil
+}
+
+// readJSONTable читает массив объектов. Столбцы - все встретившиеся ключи.
+func readJSONTable(r io.Reader) (Table, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var records []map[string]interface{}
+	if err := decoder.Decode(&records); err != nil {
+		return Table{}, err
+	}
+	seen := make(map[string]bool)
+	var t Table
+	for _, record := range records {
+		for key := range record {
+			if !seen[key] {
+				seen[key] = true
+				t.Header = append(t.Header, key)
+			}
+		}
+	}
+	sort.Strings(t.Header)
+	for _, record := range records {
+		row := make([]string, len(t.Header))
+		for i, h := range t.Header {
+			if v, ok := record[h]; ok && v != nil {
+				row[i] = fmt.Sprint(v)
+			}
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t, nil
+}
+
+// tableRow - строка таблицы с доступом к значениям по названию столбца.
+type tableRow struct {
+	columns map[string]int
+	row     []string
+}
+
+func (r tableRow) get(column string) string {
+	if i, ok := r.columns[column]; ok && i < len(r.row) {
+		return strings.TrimSpace(r.row[i])
+	}
+	return ""
+}
+
+func (r tableRow) int(column string) (int, error) {
+	v := r.get(column)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s должен быть числом: %s", column, v)
+	}
+	return n, nil
+}
+
+func (r tableRow) time(column string) (time.Time, error) {
+	v := r.get(column)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: неверное время %s", column, v)
+	}
+	return t, nil
+}
+
+// eachRow вызывает fn для каждой строки t, проверив, что в таблице есть столбцы required.
+func eachRow(t Table, required []string, fn func(r tableRow) error) error {
+	columns := make(map[string]int, len(t.Header))
+	for i, h := range t.Header {
+		columns[strings.TrimSpace(h)] = i
+	}
+	for _, c := range required {
+		if _, ok := columns[c]; !ok {
+			return fmt.Errorf("%s: нет столбца %q", t.Name, c)
+		}
+	}
+	for i, row := range t.Rows {
+		if err := fn(tableRow{columns: columns, row: row}); err != nil {
+			// строка 1 - заголовок
+			return fmt.Errorf("%s, строка %d: %v", t.Name, i+2, err)
+		}
+	}
+	return nil
+}
+
+// ImportTables собирает ImportData из таблиц с теми же столбцами, что и в выгрузке
+// бота: questions - список вопросов, answers - ответы. Номер вопроса ответа берётся
+// из столбца "Question ID", а если его нет - из имени файла answers_<номер>.
+// Столбец "Tags" перечисляет теги вопроса через пробел или запятую; в выгрузках
+// без него тег берётся из имени файла questions_<тег>. Авторы определяются по
+// обязательному столбцу "Username" и связываются с пользователями бота с тем же именем.
+func ImportTables(questions Table, answers []Table) (ImportData, error) {
+	var data ImportData
+	users := make(map[string]bool)
+	addUser := func(username string) string {
+		if !users[username] {
+			users[username] = true
+			data.Users = append(data.Users, ImportUser{ID: username, Username: username, Match: true})
+		}
+		return username
+	}
+
+	fileTag := ""
+	if tag, ok := strings.CutPrefix(questions.Name, "questions_"); ok {
+		fileTag = tag
+	}
+	err := eachRow(questions, []string{"Question ID", "Question Text", "Username"}, func(r tableRow) error {
+		likes, err := r.int("Like Count")
+		if err != nil {
+			return err
+		}
+		created, err := r.time("Created At")
+		if err != nil {
+			return err
+		}
+		tags := strings.FieldsFunc(r.get("Tags"), func(c rune) bool {
+			return c == ',' || c == ' '
+		})
+		if len(tags) == 0 && fileTag != "" {
+			tags = []string{fileTag}
+		}
+		data.Questions = append(data.Questions, ImportQuestion{
+			ID:        r.get("Question ID"),
+			UserID:    addUser(r.get("Username")),
+			Text:      r.get("Question Text"),
+			Tags:      tags,
+			CreatedAt: created,
+			Likes:     likes,
+		})
+		return nil
+	})
+	if err != nil {
+		return ImportData{}, err
+	}
+
+	for _, t := range answers {
+		fileQuestion := strings.TrimPrefix(t.Name, "answers_")
+		if _, err := strconv.ParseInt(fileQuestion, 10, 64); err != nil {
+			fileQuestion = ""
+		}
+		err := eachRow(t, []string{"Answer ID", "Answer Text", "Username"}, func(r tableRow) error {
+			questionID := r.get("Question ID")
+			if questionID == "" {
+				questionID = fileQuestion
+			}
+			if questionID == "" {
+				return fmt.Errorf("не указан Question ID")
+			}
+			likes, err := r.int("Like Count")
+			if err != nil {
+				return err
+			}
+			created, err := r.time("Created At")
+			if err != nil {
+				return err
+			}
+			data.Answers = append(data.Answers, ImportAnswer{
+				ID:         r.get("Answer ID"),
+				QuestionID: questionID,
+				UserID:     addUser(r.get("Username")),
+				Text:       r.get("Answer Text"),
+				CreatedAt:  created,
+				Likes:      likes,
+			})
+			return nil
+		})
+		if err != nil {
+			return ImportData{}, err
+		}
+	}
+	return data, nil
+}
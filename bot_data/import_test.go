@@ -0,0 +1,217 @@
+package bot_data
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestImport(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice := testUser(1, "alice")
+		b.Start(alice)
+
+		created := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+		data := ImportData{
+			Users: []ImportUser{
+				{ID: "10", Username: "alice", Match: true},
+				{ID: "11", Username: "carol"},
+			},
+			Tags: []ImportTag{{Name: "SQL", Description: "Язык запросов"}},
+			Questions: []ImportQuestion{
+				{ID: "q1", UserID: "11", Text: "Как сделать JOIN?", Tags: []string{"sql", "#Postgres"}, CreatedAt: created, Likes: 3},
+				{ID: "q2", UserID: "11", Text: " "},
+			},
+			Answers: []ImportAnswer{
+				{ID: "a1", QuestionID: "q1", UserID: "10", Text: "Через ON", Likes: 2},
+				{ID: "a2", QuestionID: "missing", UserID: "10", Text: "Ответ без вопроса"},
+			},
+		}
+		result, err := b.Import(alice.ID, "forum", 0, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := ImportResult{UsersCreated: 1, TagsCreated: 2, QuestionsCreated: 1, AnswersCreated: 1, Skipped: 2}
+		if result != want {
+			t.Fatalf("итог импорта %+v, ожидался %+v", result, want)
+		}
+
+		list, _, err := b.ListQuestions(QuestionFilter{Order: OrderNewest, Limit: 10})
+		if err != nil || len(list) != 1 {
+			t.Fatalf("вопросы после импорта: %v, %v", list, err)
+		}
+		q, err := b.Question(0, list[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q.UserID >= 0 || q.Username != "carol" || !q.CreatedAt.Equal(created) || q.Likes != 3 {
+			t.Errorf("перенесённый вопрос: %+v", q.QuestionSummary)
+		}
+		if len(q.AnswerList) != 1 || q.AnswerList[0].UserID != alice.ID || q.AnswerList[0].Likes != 2 {
+			t.Errorf("перенесённый ответ: %+v", q.AnswerList)
+		}
+
+		// лайк, поставленный в боте, переживает повторный импорт
+		expect(t, b.Like_Question(alice, strconv.FormatInt(q.ID, 10)), "like_added")
+		data.Questions[0].Likes = 5
+		result, err = b.Import(alice.ID, "forum", 0, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (ImportResult{QuestionsUpdated: 1, Skipped: 2}); result != want {
+			t.Fatalf("итог повторного импорта %+v, ожидался %+v", result, want)
+		}
+		if q, _ = b.Question(0, q.ID); q.Likes != 6 {
+			t.Errorf("лайков после повторного импорта %d, ожидалось 6", q.Likes)
+		}
+		if _, _, err := b.RecountCounters(); err != nil {
+			t.Fatal(err)
+		}
+		if q, _ = b.Question(0, q.ID); q.Likes != 6 {
+			t.Errorf("лайков после пересчёта %d, ожидалось 6", q.Likes)
+		}
+
+		// вопрос, закрытый в боте, остаётся закрытым, если источник не знает о закрытии
+		if _, err := b.dtbase.Db.Exec("UPDATE public.questions SET is_closed = true WHERE question_id = $1;", q.ID); err != nil {
+			t.Fatal(err)
+		}
+		closed := func() (closed bool) {
+			t.Helper()
+			if err := b.dtbase.Db.QueryRow("SELECT is_closed FROM public.questions WHERE question_id = $1;", q.ID).Scan(&closed); err != nil {
+				t.Fatal(err)
+			}
+			return closed
+		}
+		if _, err := b.Import(alice.ID, "forum", 0, data); err != nil {
+			t.Fatal(err)
+		}
+		if !closed() {
+			t.Error("повторный импорт открыл закрытый вопрос")
+		}
+		open := false
+		data.Questions[0].Closed = &open
+		if _, err := b.Import(alice.ID, "forum", 0, data); err != nil {
+			t.Fatal(err)
+		}
+		if closed() {
+			t.Error("вопрос не открыт, хотя в источнике он открыт")
+		}
+
+		if _, err := b.Import(alice.ID, "forum", 42, data); err == nil {
+			t.Error("импорт в несуществующее сообщество")
+		}
+	})
+}
+
+func TestImportTables(t *testing.T) {
+	questions := Table{
+		Header: []string{"Question ID", "Question Text", "Username", "Tags", "Like Count"},
+		Rows:   [][]string{{"7", "Что выбрать?", "dave", "go, sql", "4"}},
+	}
+	answers := Table{
+		Name:   "answers_7",
+		Header: []string{"Answer ID", "Answer Text", "Username"},
+		Rows:   [][]string{{"1", "Оба", "erin"}},
+	}
+	data, err := ImportTables(questions, []Table{answers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Questions) != 1 || data.Questions[0].Likes != 4 || len(data.Questions[0].Tags) != 2 {
+		t.Fatalf("вопросы: %+v", data.Questions)
+	}
+	if len(data.Answers) != 1 || data.Answers[0].QuestionID != "7" {
+		t.Fatalf("ответы: %+v", data.Answers)
+	}
+}
+
+// TestImportOwnExport проверяет, что выгрузки бота импортируются без потери тегов и авторов.
+func TestImportOwnExport(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice, bob := testUser(1, "alice"), testUser(2, "bob")
+		b.Start(alice)
+		b.Start(bob)
+		ask(t, b, alice, "Как читать из канала с таймаутом? #go #concurrency")
+		ask(t, b, bob, "Чем отличается make от new? #go")
+
+		roundTrip := func(table Table) Table {
+			t.Helper()
+			var buf bytes.Buffer
+			if err := (csvExporter{}).Write(&buf, table); err != nil {
+				t.Fatal(err)
+			}
+			read, err := readCSVTable(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			read.Name = table.Name
+			return read
+		}
+		authors := func(data ImportData) map[string][]string {
+			result := map[string][]string{}
+			for _, q := range data.Questions {
+				result[q.UserID] = append(result[q.UserID], q.Tags...)
+			}
+			return result
+		}
+
+		s := b.settings(alice.ID)
+		questions, err := b.questionsByTag(0, "go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ImportTables(roundTrip(questionsTable(s, "go", questions)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string][]string{"alice": {"concurrency", "go"}, "bob": {"go"}}
+		if got := authors(data); !reflect.DeepEqual(got, want) {
+			t.Errorf("questions_go: %v, ожидалось %v", got, want)
+		}
+
+		// выгрузки без столбца Tags: тег берётся из имени файла
+		legacy := questionsTable(s, "go", questions)
+		legacy.Header = legacy.Header[:len(legacy.Header)-1]
+		for i, row := range legacy.Rows {
+			legacy.Rows[i] = row[:len(row)-1]
+		}
+		if data, err = ImportTables(roundTrip(legacy), nil); err != nil {
+			t.Fatal(err)
+		}
+		want = map[string][]string{"alice": {"go"}, "bob": {"go"}}
+		if got := authors(data); !reflect.DeepEqual(got, want) {
+			t.Errorf("questions_go без тегов: %v, ожидалось %v", got, want)
+		}
+
+		mine, err := b.userQuestions(alice, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err = ImportTables(roundTrip(myQuestionsTable(s, mine)), nil); err != nil {
+			t.Fatal(err)
+		}
+		want = map[string][]string{"alice": {"concurrency", "go"}}
+		if got := authors(data); !reflect.DeepEqual(got, want) {
+			t.Errorf("my_questions: %v, ожидалось %v", got, want)
+		}
+		if _, err := b.Import(alice.ID, "export", 0, data); err != nil {
+			t.Fatal(err)
+		}
+		imported, err := b.userQuestions(alice, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(imported) != 2 || !slices.Equal(imported[1].Tags, []string{"concurrency", "go"}) {
+			t.Errorf("вопросы alice после импорта: %+v", imported)
+		}
+
+		// без столбца Username все вопросы достались бы одному безымянному автору
+		noAuthor := Table{Name: "my_questions", Header: []string{"Question ID", "Question Text"}, Rows: [][]string{{"1", "Вопрос"}}}
+		if _, err := ImportTables(noAuthor, nil); err == nil {
+			t.Error("импорт таблицы без столбца Username")
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package bot_data
+
+import (
+	"fmt"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// notifyExcerptLength - сколько символов ответа показывать в уведомлении
+const notifyExcerptLength = 200
+
+func displayName(u *tgbotapi.User) string {
+	if u.UserName != "" {
+		return "@" + u.UserName
+	}
+	return u.FirstName
+}
+
+// canNotify - у авторов, перенесённых импортом, нет чата в Telegram: их номера
+// отрицательные, а отрицательные chat_id в Telegram принадлежат группам.
+func canNotify(owner int64) bool {
+	return owner > 0
+}
+
+// questionOwner и answerOwner читают через q, чтобы внутри транзакции не занимать
+// второе соединение из пула.
+func questionOwner(q dbtx, questionID int64) int64 {
+	var owner int64
+	q.QueryRow("SELECT user_id FROM public.questions WHERE question_id = $1;", questionID).Scan(&owner)
+	return owner
+}
+
+func answerOwner(q dbtx, answerID int64) int64 {
+	var owner int64
+	q.QueryRow("SELECT user_id FROM public.answers WHERE answer_id = $1;", answerID).Scan(&owner)
+	return owner
+}
+
+// notifyAnswer ставит в outbox уведомление автору вопроса о новом ответе,
+// если он включил такие уведомления.
+func (b *Bot) notifyAnswer(tx dbtx, from *tgbotapi.User, questionID, answerID int64, text string) error {
+	owner := questionOwner(tx, questionID)
+	if !canNotify(owner) || owner == from.ID {
+		return nil
+	}
+	s := readSettings(tx, owner)
+	if !s.NotifyAnswers {
+		return nil
+	}
+	return enqueueMessage(tx, fmt.Sprintf("notify_answer:%d", answerID), owner,
+		tr(s.Locale, "notify_answer", questionID, displayName(from), excerpt(text, notifyExcerptLength)))
+}
+
+func (b *Bot) notifyQuestionLike(tx dbtx, from *tgbotapi.User, questionID int64) error {
+	owner := questionOwner(tx, questionID)
+	if !canNotify(owner) || owner == from.ID {
+		return nil
+	}
+	s := readSettings(tx, owner)
+	if !s.NotifyLikes {
+		return nil
+	}
+	return enqueueMessage(tx, fmt.Sprintf("notify_question_like:%d:%d", questionID, from.ID), owner,
+		tr(s.Locale, "notify_question_like", displayName(from), questionID))
+}
+
+func (b *Bot) notifyAnswerLike(tx dbtx, from *tgbotapi.User, answerID int64) error {
+	owner := answerOwner(tx, answerID)
+	if !canNotify(owner) || owner == from.ID {
+		return nil
+	}
+	s := readSettings(tx, owner)
+	if !s.NotifyLikes {
+		return nil
+	}
+	return enqueueMessage(tx, fmt.Sprintf("notify_answer_like:%d:%d", answerID, from.ID), owner,
+		tr(s.Locale, "notify_answer_like", displayName(from), answerID))
+}
@@ -0,0 +1,202 @@
+package bot_data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// Побочные эффекты команд (уведомления в Telegram, вебхуки) не выполняются сразу,
+// а записываются в таблицу outbox в той же транзакции, что и изменение данных.
+// Диспетчер RunOutbox доставляет их не менее одного раза, повторяя неудачные попытки.
+
+var (
+	OutboxInterval = flag.Duration("outbox.interval", time.Second, "how often the outbox dispatcher looks for pending entries")
+	OutboxBatch    = flag.Int("outbox.batch", 50, "outbox entries claimed by the dispatcher at once")
+	OutboxAttempts = flag.Int("outbox.attempts", 5, "delivery attempts per outbox entry")
+	OutboxBackoff  = flag.Duration("outbox.backoff", time.Second, "delay before the first outbox retry, doubled after each attempt")
+	OutboxLease    = flag.Duration("outbox.lease", 5*time.Minute, "how long a claimed outbox entry stays reserved for its dispatcher before it can be retried")
+)
+
+// Виды записей outbox
+const (
+	outboxMessage = "message"
+	outboxWebhook = "webhook"
+)
+
+// dbtx - общее у *sql.DB и *sql.Tx, чтобы одни и те же функции можно было
+// вызывать как внутри транзакции, так и без неё.
+type dbtx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// inTx выполняет fn в транзакции и фиксирует её, если fn не вернула ошибку.
+func (b *Bot) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := b.dtbase.Db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// messageJob - сообщение пользователю Telegram.
+type messageJob struct {
+	ChatID int64  `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+// enqueue добавляет запись в outbox. Запись с уже существующим ключом key
+// игнорируется, так что повторная обработка одного события не дублирует доставку.
+func enqueue(tx dbtx, kind, key string, job interface{}) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO public.outbox (kind, dedup_key, payload)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (dedup_key) DO NOTHING;
+	`
+	_, err = tx.Exec(query, kind, key, payload)
+	return err
+}
+
+func enqueueMessage(tx dbtx, key string, chatID int64, text string) error {
+	return enqueue(tx, outboxMessage, key, messageJob{ChatID: chatID, Text: text})
+}
+
+type outboxEntry struct {
+	id      int64
+	kind    string
+	payload []byte
+	// attempts - номер текущей попытки доставки
+	attempts int
+}
+
+// RunOutbox доставляет записи outbox, пока не отменён ctx.
+func (b *Bot) RunOutbox(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// полная пачка значит, что в очереди могут быть ещё записи
+		for b.dispatchOutbox() == *OutboxBatch {
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchOutbox забирает и доставляет пачку готовых записей и возвращает их число.
+// Транзакция держится только на время захвата записей: доставка может ждать
+// Telegram или чужой сервер, и всё это время строки outbox и соединение были бы заняты.
+func (b *Bot) dispatchOutbox() int {
+	if !b.Available() {
+		return 0
+	}
+	entries, err := b.claimOutbox()
+	if err != nil {
+		log.Printf("Ошибка при чтении outbox: %v", err)
+		return 0
+	}
+
+	for _, e := range entries {
+		if err := b.deliverEntry(e); err != nil {
+			log.Printf("Outbox %d (%s), попытка %d: %v", e.id, e.kind, e.attempts, err)
+			delay := *OutboxBackoff << (e.attempts - 1)
+			query := "UPDATE public.outbox SET last_error = $2, next_attempt_at = $3 WHERE outbox_id = $1;"
+			if _, err := b.dtbase.Db.Exec(query, e.id, err.Error(), time.Now().Add(delay)); err != nil {
+				log.Printf("Ошибка при обновлении outbox: %v", err)
+			}
+			continue
+		}
+		query := "UPDATE public.outbox SET last_error = '', sent_at = NOW() WHERE outbox_id = $1;"
+		if _, err := b.dtbase.Db.Exec(query, e.id); err != nil {
+			// после окончания аренды запись будет отправлена повторно
+			log.Printf("Ошибка при обновлении outbox: %v", err)
+		}
+	}
+	return len(entries)
+}
+
+// claimOutbox берёт в аренду пачку готовых записей: засчитывает попытку и откладывает
+// следующую на *OutboxLease. SKIP LOCKED позволяет нескольким экземплярам бота
+// разбирать outbox, не забирая одни и те же записи, а если экземпляр упадёт во время
+// доставки, запись снова станет доступна после окончания аренды.
+func (b *Bot) claimOutbox() ([]outboxEntry, error) {
+	var entries []outboxEntry
+	err := b.inTx(func(tx *sql.Tx) error {
+		query := `
+			SELECT outbox_id, kind, payload, attempts
+			FROM public.outbox
+			WHERE sent_at IS NULL AND attempts < $2 AND next_attempt_at <= NOW()
+			ORDER BY outbox_id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED;
+		`
+		rows, err := tx.Query(query, *OutboxBatch, *OutboxAttempts)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var e outboxEntry
+			if err := rows.Scan(&e.id, &e.kind, &e.payload, &e.attempts); err != nil {
+				rows.Close()
+				return err
+			}
+			e.attempts++
+			entries = append(entries, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		lease := time.Now().Add(*OutboxLease)
+		for _, e := range entries {
+			query := "UPDATE public.outbox SET attempts = $2, next_attempt_at = $3 WHERE outbox_id = $1;"
+			if _, err := tx.Exec(query, e.id, e.attempts, lease); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (b *Bot) deliverEntry(e outboxEntry) error {
+	switch e.kind {
+	case outboxMessage:
+		var job messageJob
+		if err := json.Unmarshal(e.payload, &job); err != nil {
+			return err
+		}
+		_, err := b.API.Send(tgbotapi.NewMessage(job.ChatID, job.Text))
+		return err
+	case outboxWebhook:
+		var job webhookJob
+		if err := json.Unmarshal(e.payload, &job); err != nil {
+			return err
+		}
+		return b.deliverWebhook(e.id, job)
+	}
+	return fmt.Errorf("неизвестный вид записи: %s", e.kind)
+}
@@ -0,0 +1,88 @@
+package bot_data
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDispatchOutbox(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		var status, calls atomic.Int32
+		status.Store(http.StatusInternalServerError)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(int(status.Load()))
+		}))
+		defer server.Close()
+
+		db := b.dtbase.Db
+		if _, err := db.Exec("INSERT INTO public.webhooks (url, secret) VALUES ($1, 'secret');", server.URL); err != nil {
+			t.Fatal(err)
+		}
+		alice := testUser(1, "alice")
+		b.Start(alice)
+		ask(t, b, alice, "Как проверить доставку вебхуков? #webhooks")
+
+		entry := func() (attempts int, sent bool, lastError string) {
+			t.Helper()
+			err := db.QueryRow("SELECT attempts, sent_at IS NOT NULL, last_error FROM public.outbox;").Scan(&attempts, &sent, &lastError)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return attempts, sent, lastError
+		}
+
+		// неудачная попытка засчитывается, и следующая откладывается
+		if n := b.dispatchOutbox(); n != 1 {
+			t.Fatalf("доставлено %d записей, ожидалась 1", n)
+		}
+		if attempts, sent, lastError := entry(); attempts != 1 || sent || lastError == "" {
+			t.Fatalf("после ошибки: попыток %d, отправлено %v, ошибка %q", attempts, sent, lastError)
+		}
+		if n := b.dispatchOutbox(); n != 0 {
+			t.Fatalf("запись повторена раньше срока: %d", n)
+		}
+
+		status.Store(http.StatusOK)
+		if _, err := db.Exec("UPDATE public.outbox SET next_attempt_at = NOW();"); err != nil {
+			t.Fatal(err)
+		}
+		if n := b.dispatchOutbox(); n != 1 {
+			t.Fatalf("повтор: доставлено %d записей", n)
+		}
+		if attempts, sent, lastError := entry(); attempts != 2 || !sent || lastError != "" {
+			t.Fatalf("после доставки: попыток %d, отправлено %v, ошибка %q", attempts, sent, lastError)
+		}
+		if calls.Load() != 2 {
+			t.Errorf("запросов к вебхуку %d, ожидалось 2", calls.Load())
+		}
+		var deliveries int
+		if err := db.QueryRow("SELECT attempts FROM public.webhookdeliveries WHERE delivered_at IS NOT NULL;").Scan(&deliveries); err != nil {
+			t.Fatal(err)
+		}
+		if deliveries != 2 {
+			t.Errorf("в журнале доставок %d попыток, ожидалось 2", deliveries)
+		}
+	})
+}
+
+func TestClaimOutboxLease(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		if err := enqueueMessage(b.dtbase.Db, "test", 1, "текст"); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := b.claimOutbox()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].attempts != 1 {
+			t.Fatalf("взято в аренду: %+v", entries)
+		}
+		// пока аренда не закончилась, другой диспетчер запись не получит
+		if entries, err = b.claimOutbox(); err != nil || len(entries) != 0 {
+			t.Fatalf("запись взята повторно: %+v, %v", entries, err)
+		}
+	})
+}
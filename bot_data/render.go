@@ -0,0 +1,131 @@
+package bot_data
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+const (
+	// maxMessageLength - ограничение Telegram на длину сообщения (в UTF-16 символах)
+	maxMessageLength = 4096
+	// maxReplyMessages - больше сообщений подряд не отправляем, вместо этого отправляем файл
+	maxReplyMessages = 5
+)
+
+// Reply - ответ бота. Records - самостоятельные части текста (например, по одной на вопрос),
+// по их границам длинный ответ делится на несколько сообщений, поэтому разметка
+// не переходит из одного сообщения в другое. Если задан Format, записи уже размечены им.
+// Files отправляются документами перед текстом, Attachments пересылаются после него.
+type Reply struct {
+	Records     []string
+	Markup      interface{}
+	Format      Formatter
+	Files       []ExportFile
+	Attachments []Attachment
+}
+
+// Text - ответ из одного сообщения.
+func Text(text string) Reply {
+	return Reply{Records: []string{text}}
+}
+
+// Empty сообщает, что отправлять нечего.
+func (r Reply) Empty() bool {
+	for _, rec := range r.Records {
+		if rec != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Reply) String() string {
+	return strings.Join(r.Records, "")
+}
+
+func textLength(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// splitRecords собирает записи в сообщения не длиннее limit. Возвращает false,
+// если какая-то запись сама по себе не помещается в одно сообщение.
+func splitRecords(records []string, limit int) ([]string, bool) {
+	var chunks []string
+	var current strings.Builder
+	currentLength := 0
+	for _, rec := range records {
+		l := textLength(rec)
+		if l > limit {
+			return nil, false
+		}
+		if currentLength+l > limit {
+			chunks = append(chunks, current.String())
+			current.Reset()
+			currentLength = 0
+		}
+		current.WriteString(rec)
+		currentLength += l
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks, true
+}
+
+// SendReply отправляет ответ, при необходимости разбивая его на несколько сообщений
+// по границам записей. Если ответ слишком длинный, он отправляется текстовым файлом.
+// Клавиатура прикрепляется к последнему сообщению.
+func (b *Bot) SendReply(chatID int64, r Reply) error {
+	if r.Empty() {
+		return nil
+	}
+	for _, f := range r.Files {
+		if err := b.sendExport(chatID, f.Format, f.Table); err != nil {
+			return err
+		}
+	}
+
+	chunks, ok := splitRecords(r.Records, maxMessageLength)
+	if !ok || len(chunks) > maxReplyMessages {
+		if err := b.sendReplyDocument(chatID, r); err != nil {
+			return err
+		}
+		return b.sendAttachments(chatID, r.Attachments)
+	}
+
+	for i, chunk := range chunks {
+		if strings.TrimSpace(chunk) == "" {
+			continue
+		}
+		msg := tgbotapi.NewMessage(chatID, chunk)
+		if r.Format != nil {
+			msg.ParseMode = r.Format.ParseMode()
+		}
+		if i == len(chunks)-1 && r.Markup != nil {
+			msg.ReplyMarkup = r.Markup
+		}
+		if _, err := b.API.Send(msg); err != nil {
+			return err
+		}
+	}
+	return b.sendAttachments(chatID, r.Attachments)
+}
+
+// sendReplyDocument отправляет ответ текстовым файлом, разметка из него убирается.
+func (b *Bot) sendReplyDocument(chatID int64, r Reply) error {
+	text := r.String()
+	if r.Format != nil {
+		text = r.Format.Strip(text)
+	}
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+		Name:  "reply.txt",
+		Bytes: []byte(text),
+	})
+	if r.Markup != nil {
+		doc.ReplyMarkup = r.Markup
+	}
+	_, err := b.API.Send(doc)
+	return err
+}
@@ -0,0 +1,77 @@
+package bot_data
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTextLength(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"вопрос", 6},
+		// символы вне BMP занимают в UTF-16 по два
+		{"😀", 2},
+		{"a😀b", 4},
+	}
+	for _, tt := range tests {
+		if got := textLength(tt.in); got != tt.want {
+			t.Errorf("textLength(%q) = %d, ожидалось %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitRecords(t *testing.T) {
+	emoji := func(n int) string { return strings.Repeat("😀", n) }
+	tests := []struct {
+		name    string
+		records []string
+		limit   int
+		want    []string
+		ok      bool
+	}{
+		{name: "пусто", records: nil, limit: 10, want: nil, ok: true},
+		{name: "в одно сообщение", records: []string{"ab", "cd"}, limit: 4, want: []string{"abcd"}, ok: true},
+		{name: "по границе записи", records: []string{"ab", "cd", "e"}, limit: 4, want: []string{"abcd", "e"}, ok: true},
+		{name: "запись длиннее лимита", records: []string{"ab", "cdefg"}, limit: 4, ok: false},
+		// считаются UTF-16 символы, а не байты и не руны
+		{name: "кириллица", records: []string{"вопрос", "ответ"}, limit: 11, want: []string{"вопросответ"}, ok: true},
+		{name: "эмодзи", records: []string{emoji(2), "a"}, limit: 4, want: []string{emoji(2), "a"}, ok: true},
+		{name: "эмодзи не помещается", records: []string{emoji(3)}, limit: 5, ok: false},
+		{
+			name:    "ровно лимит Telegram",
+			records: []string{strings.Repeat("я", maxMessageLength-2), emoji(1), "!"},
+			limit:   maxMessageLength,
+			want:    []string{strings.Repeat("я", maxMessageLength-2) + emoji(1), "!"},
+			ok:      true,
+		},
+		{
+			name:    "эмодзи на границе лимита",
+			records: []string{strings.Repeat("я", maxMessageLength-1), emoji(1)},
+			limit:   maxMessageLength,
+			want:    []string{strings.Repeat("я", maxMessageLength-1), emoji(1)},
+			ok:      true,
+		},
+		{
+			name:    "в рунах помещается, в UTF-16 нет",
+			records: []string{emoji(maxMessageLength/2 + 1)},
+			limit:   maxMessageLength,
+			ok:      false,
+		},
+	}
+	for _, tt := range tests {
+		got, ok := splitRecords(tt.records, tt.limit)
+		if ok != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %d сообщений, %v; ожидалось %d, %v", tt.name, len(got), ok, len(tt.want), tt.ok)
+		}
+		for _, chunk := range got {
+			if textLength(chunk) > tt.limit {
+				t.Errorf("%s: сообщение длиной %d больше лимита %d", tt.name, textLength(chunk), tt.limit)
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package bot_data
+
+import (
+	"database/sql"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+const (
+	defaultTimeZone = "Europe/Moscow"
+	// timeLayout - формат времени в сообщениях
+	timeLayout = "02.01.2006 15:04"
+
+	callbackSettings = "set:"
+)
+
+// menuTimeZones - часовые пояса, которые предлагаются кнопками. Любой другой
+// можно задать командой /settings timezone <зона>.
+var menuTimeZones = []string{"Europe/Kaliningrad", "Europe/Moscow", "Asia/Yekaterinburg", "Asia/Novosibirsk", "Asia/Vladivostok", "UTC"}
+
+// Settings - пользовательские настройки бота.
+type Settings struct {
+	Locale            string `json:"locale"`
+	TimeZone          string `json:"timezone"`
+	ExportAttachments bool   `json:"export_attachments"`
+	ExportFormat      string `json:"export_format"`
+	DigestFrequency   string `json:"digest"`
+	NotifyAnswers     bool   `json:"notify_answers"`
+	NotifyLikes       bool   `json:"notify_likes"`
+	// CommunityID - активное сообщество, 0 - общее пространство вне сообществ
+	CommunityID int64 `json:"community_id"`
+}
+
+func defaultSettings() Settings {
+	return Settings{
+		Locale:            defaultLocale,
+		TimeZone:          defaultTimeZone,
+		ExportAttachments: true,
+		ExportFormat:      defaultExportFormat,
+		DigestFrequency:   "off",
+		NotifyAnswers:     true,
+		NotifyLikes:       false,
+	}
+}
+
+// Location возвращает часовой пояс пользователя.
+func (s Settings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// FormatTime форматирует время в часовом поясе пользователя.
+func (s Settings) FormatTime(t time.Time) string {
+	return t.In(s.Location()).Format(timeLayout)
+}
+
+// settings читает настройки пользователя. Для незаполненных настроек возвращаются значения по умолчанию.
+func (b *Bot) settings(userID int64) Settings {
+	if s, ok := b.cache.settings.Get(userID); ok {
+		return s
+	}
+	s := readSettings(b.dtbase.Db, userID)
+	b.cache.settings.Set(userID, s)
+	return s
+}
+
+// readSettings читает настройки через q без кэша: внутри транзакции передаётся сама транзакция.
+func readSettings(q dbtx, userID int64) Settings {
+	s := defaultSettings()
+	query := `
+		SELECT locale, timezone, export_attachments, export_format, notify_answers, notify_likes, COALESCE(community_id, 0)
+		FROM public.usersettings
+		WHERE user_id = $1;
+	`
+	err := q.QueryRow(query, userID).Scan(&s.Locale, &s.TimeZone, &s.ExportAttachments, &s.ExportFormat, &s.NotifyAnswers, &s.NotifyLikes, &s.CommunityID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Ошибка при чтении настроек пользователя: %v", err)
+	}
+
+	err = q.QueryRow("SELECT frequency FROM public.digestsettings WHERE user_id = $1;", userID).Scan(&s.DigestFrequency)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Ошибка при чтении настроек дайджеста: %v", err)
+	}
+	return s
+}
+
+// settingColumns сопоставляет параметр /settings с колонкой usersettings.
+var settingColumns = map[string]string{
+	"locale":         "locale",
+	"timezone":       "timezone",
+	"export":         "export_attachments",
+	"format":         "export_format",
+	"notify_answers": "notify_answers",
+	"notify_likes":   "notify_likes",
+}
+
+// parseSetting проверяет значение настройки и приводит его к виду для записи в базу.
+func parseSetting(key, value string) (interface{}, bool) {
+	switch key {
+	case "locale":
+		for _, l := range locales {
+			if l == value {
+				return value, true
+			}
+		}
+		return nil, false
+	case "timezone":
+		if _, err := time.LoadLocation(value); err != nil || value == "" || value == "Local" {
+			return nil, false
+		}
+		return value, true
+	case "format":
+		exporter, ok := LookupExporter(value)
+		if !ok {
+			return nil, false
+		}
+		return exporter.Extension(), true
+	case "digest":
+		if _, ok := digestPeriods[value]; !ok && value != "off" {
+			return nil, false
+		}
+		return value, true
+	case "export", "notify_answers", "notify_likes":
+		switch value {
+		case "on":
+			return true, true
+		case "off":
+			return false, true
+		}
+	}
+	return nil, false
+}
+
+// updateSetting сохраняет одну настройку пользователя.
+func (b *Bot) updateSetting(userID int64, key, value string) error {
+	v, ok := parseSetting(key, value)
+	if !ok {
+		return newError("settings_bad_value")
+	}
+	if key == "digest" {
+		return b.changeSettings(userID, func(tx *sql.Tx) error {
+			return setDigestFrequency(tx, userID, value)
+		})
+	}
+	column, ok := settingColumns[key]
+	if !ok {
+		return newError("settings_bad_key")
+	}
+	return b.changeSettings(userID, func(tx *sql.Tx) error {
+		return setSettingColumn(tx, userID, column, v)
+	})
+}
+
+// changeSettings выполняет fn в транзакции и записывает в журнал настройки
+// до изменения и после него. Кэш настроек сбрасывается после фиксации.
+func (b *Bot) changeSettings(userID int64, fn func(tx *sql.Tx) error) error {
+	defer b.cache.settings.Delete(userID)
+	return b.inTx(func(tx *sql.Tx) error {
+		before := readSettings(tx, userID)
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return audit(tx, userID, AuditSettingsUpdate, auditTargetUser, userID, before, readSettings(tx, userID))
+	})
+}
+
+// setSettingColumn записывает значение в колонку usersettings одним запросом:
+// строка, которой ещё нет, создаётся с настройками по умолчанию и этим значением.
+// Кэш настроек сбрасывает вызывающий после фиксации транзакции.
+func setSettingColumn(q dbtx, userID int64, column string, v interface{}) error {
+	d := defaultSettings()
+	columns := []string{"user_id", "locale", "timezone", "export_attachments", "export_format", "notify_answers", "notify_likes"}
+	values := []interface{}{userID, d.Locale, d.TimeZone, d.ExportAttachments, d.ExportFormat, d.NotifyAnswers, d.NotifyLikes}
+	if i := slices.Index(columns, column); i > 0 {
+		values[i] = v
+	} else {
+		columns = append(columns, column)
+		values = append(values, v)
+	}
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+	}
+	query := `
+		INSERT INTO public.usersettings (` + strings.Join(columns, ", ") + `)
+		VALUES (` + strings.Join(placeholders, ", ") + `)
+		ON CONFLICT (user_id) DO UPDATE SET ` + column + ` = EXCLUDED.` + column + `;
+	`
+	_, err := q.Exec(query, values...)
+	return err
+}
+
+func onOff(locale string, v bool) string {
+	if v {
+		return tr(locale, "settings_on")
+	}
+	return tr(locale, "settings_off")
+}
+
+func settingsText(s Settings) string {
+	l := s.Locale
+	return tr(l, "settings_title") +
+		tr(l, "settings_line", tr(l, "settings_locale"), s.Locale) +
+		tr(l, "settings_line", tr(l, "settings_timezone"), s.TimeZone) +
+		tr(l, "settings_line", tr(l, "settings_export"), onOff(l, s.ExportAttachments)) +
+		tr(l, "settings_line", tr(l, "settings_format"), s.ExportFormat) +
+		tr(l, "settings_line", tr(l, "settings_digest"), s.DigestFrequency) +
+		tr(l, "settings_line", tr(l, "settings_notify_answer"), onOff(l, s.NotifyAnswers)) +
+		tr(l, "settings_line", tr(l, "settings_notify_likes"), onOff(l, s.NotifyLikes)) +
+		tr(l, "settings_hint")
+}
+
+// settingButton - кнопка выбора значения, текущее значение отмечено галочкой.
+func settingButton(key, value, label string, current bool) tgbotapi.InlineKeyboardButton {
+	if current {
+		label = "✓ " + label
+	}
+	return tgbotapi.NewInlineKeyboardButtonData(label, callbackSettings+key+":"+value)
+}
+
+func settingsKeyboard(s Settings) *tgbotapi.InlineKeyboardMarkup {
+	l := s.Locale
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, locale := range locales {
+		row = append(row, settingButton("locale", locale, locale, s.Locale == locale))
+	}
+	rows = append(rows, row)
+
+	row = nil
+	for i, zone := range menuTimeZones {
+		row = append(row, settingButton("timezone", zone, zone, s.TimeZone == zone))
+		if i%2 == 1 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	toggle := func(key, title string, v bool) []tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardRow(
+			settingButton(key, "on", title+": "+tr(l, "settings_on"), v),
+			settingButton(key, "off", title+": "+tr(l, "settings_off"), !v),
+		)
+	}
+	rows = append(rows, toggle("export", tr(l, "settings_export"), s.ExportAttachments))
+
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		settingButton("format", "csv", "csv", s.ExportFormat == "csv"),
+		settingButton("format", "json", "json", s.ExportFormat == "json"),
+		settingButton("format", "md", "md", s.ExportFormat == "md"),
+		settingButton("format", "html", "html", s.ExportFormat == "html"),
+	))
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		settingButton("digest", "daily", "daily", s.DigestFrequency == "daily"),
+		settingButton("digest", "weekly", "weekly", s.DigestFrequency == "weekly"),
+		settingButton("digest", "off", tr(l, "settings_digest")+": "+tr(l, "settings_off"), s.DigestFrequency == "off"),
+	))
+	rows = append(rows, toggle("notify_answers", tr(l, "settings_notify_answer"), s.NotifyAnswers))
+	rows = append(rows, toggle("notify_likes", tr(l, "settings_notify_likes"), s.NotifyLikes))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &keyboard
+}
+
+// Settings показывает настройки с inline-клавиатурой или, если переданы
+// args (параметр и значение), сразу меняет настройку.
+func (b *Bot) Settings(u *tgbotapi.User, args []string) Reply {
+	if !b.checkRegistration(u.ID) {
+		return Text(b.T(u.ID, "not_registered"))
+	}
+	if len(args) == 0 {
+		s := b.settings(u.ID)
+		return Reply{Records: []string{settingsText(s)}, Markup: settingsKeyboard(s)}
+	}
+	if len(args) != 2 {
+		return Text(b.T(u.ID, "settings_bad_key"))
+	}
+	if _, ok := settingColumns[args[0]]; !ok && args[0] != "digest" {
+		return Text(b.T(u.ID, "settings_bad_key"))
+	}
+	if err := b.updateSetting(u.ID, args[0], args[1]); err != nil {
+		log.Printf("Ошибка при сохранении настройки: %v", err)
+		return Text(b.ErrorText(u.ID, err))
+	}
+	return Text(b.T(u.ID, "settings_saved"))
+}
+
+// handleSettingsCallback сохраняет выбранное кнопкой значение и обновляет меню настроек.
+func (b *Bot) handleSettingsCallback(q *tgbotapi.CallbackQuery) string {
+	key, value, ok := strings.Cut(strings.TrimPrefix(q.Data, callbackSettings), ":")
+	if !ok || !b.checkRegistration(q.From.ID) {
+		return b.T(q.From.ID, "settings_bad_value")
+	}
+	if err := b.updateSetting(q.From.ID, key, value); err != nil {
+		log.Printf("Ошибка при сохранении настройки: %v", err)
+		return b.ErrorText(q.From.ID, err)
+	}
+
+	s := b.settings(q.From.ID)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(q.Message.Chat.ID, q.Message.MessageID, settingsText(s), *settingsKeyboard(s))
+	if _, err := b.API.Send(edit); err != nil {
+		log.Printf("Ошибка при обновлении меню настроек: %v", err)
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package bot_data
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSettingsCache(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice := testUser(1, "alice")
+		b.Start(alice)
+		if s := b.settings(alice.ID); s != defaultSettings() {
+			t.Fatalf("настройки нового пользователя: %+v", s)
+		}
+
+		// чтение идёт из кэша: изменение в обход бота не видно до сброса
+		if _, err := b.dtbase.Db.Exec("INSERT INTO public.digestsettings (user_id, frequency) VALUES ($1, 'daily');", alice.ID); err != nil {
+			t.Fatal(err)
+		}
+		if s := b.settings(alice.ID); s.DigestFrequency != "off" {
+			t.Fatalf("настройки прочитаны из базы, а не из кэша: %+v", s)
+		}
+
+		// изменения через бота сбрасывают кэш
+		if err := b.updateSetting(alice.ID, "locale", "en"); err != nil {
+			t.Fatal(err)
+		}
+		if s := b.settings(alice.ID); s.Locale != "en" || s.DigestFrequency != "daily" {
+			t.Fatalf("после смены языка: %+v", s)
+		}
+		if got, want := b.Digest(alice, "weekly"), tr("en", "digest_on", "weekly"); got != want {
+			t.Fatalf("ответ %q, ожидался %q", got, want)
+		}
+		if s := b.settings(alice.ID); s.DigestFrequency != "weekly" {
+			t.Fatalf("после смены дайджеста: %+v", s)
+		}
+		b.Community_Switch(alice, "0")
+		if err := b.updateSetting(alice.ID, "notify_likes", "on"); err != nil {
+			t.Fatal(err)
+		}
+		if s := b.settings(alice.ID); !s.NotifyLikes || s.Locale != "en" {
+			t.Fatalf("после включения уведомлений: %+v", s)
+		}
+	})
+}
+
+func TestSetSettingColumn(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice, bob := testUser(1, "alice"), testUser(2, "bob")
+		b.Start(alice)
+		b.Start(bob)
+		b.Community_Create(alice, nil, "Команда")
+
+		// строки настроек ещё нет: она создаётся со значениями по умолчанию
+		err := b.changeSettings(bob.ID, func(tx *sql.Tx) error {
+			return setSettingColumn(tx, bob.ID, "timezone", "UTC")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := defaultSettings()
+		want.TimeZone = "UTC"
+		if s := b.settings(bob.ID); s != want {
+			t.Errorf("настройки bob: %+v, ожидалось %+v", s, want)
+		}
+		// колонка вне настроек по умолчанию
+		var community int64
+		if err := b.dtbase.Db.QueryRow("SELECT community_id FROM public.communities;").Scan(&community); err != nil {
+			t.Fatal(err)
+		}
+		err = b.changeSettings(bob.ID, func(tx *sql.Tx) error {
+			return setSettingColumn(tx, bob.ID, "community_id", community)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want.CommunityID = community
+		if s := b.settings(bob.ID); s != want {
+			t.Errorf("настройки bob после смены сообщества: %+v, ожидалось %+v", s, want)
+		}
+	})
+}
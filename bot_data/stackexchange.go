@@ -0,0 +1,193 @@
+package bot_data
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Выгрузка сайта Stack Exchange - каталог с XML-файлами, в которых каждая запись -
+// элемент <row> с полями в атрибутах. Используются Posts.xml, Tags.xml и Users.xml.
+
+// Типы записей Posts.xml
+const (
+	sePostQuestion   = 1
+	sePostAnswer     = 2
+	sePostTagExcerpt = 4
+)
+
+// seTimeLayout - формат времени выгрузки, время в UTC
+const seTimeLayout = "2006-01-02T15:04:05"
+
+type sePost struct {
+	ID               string `xml:"Id,attr"`
+	PostTypeID       int    `xml:"PostTypeId,attr"`
+	ParentID         string `xml:"ParentId,attr"`
+	OwnerUserID      string `xml:"OwnerUserId,attr"`
+	OwnerDisplayName string `xml:"OwnerDisplayName,attr"`
+	Title            string `xml:"Title,attr"`
+	Body             string `xml:"Body,attr"`
+	Tags             string `xml:"Tags,attr"`
+	Score            int    `xml:"Score,attr"`
+	CreationDate     string `xml:"CreationDate,attr"`
+	ClosedDate       string `xml:"ClosedDate,attr"`
+}
+
+type seTag struct {
+	TagName       string `xml:"TagName,attr"`
+	ExcerptPostID string `xml:"ExcerptPostId,attr"`
+}
+
+type seUser struct {
+	ID           string `xml:"Id,attr"`
+	DisplayName  string `xml:"DisplayName,attr"`
+	CreationDate string `xml:"CreationDate,attr"`
+}
+
+// ReadStackExchange читает выгрузку Stack Exchange из каталога dir. Posts.xml
+// обязателен, Tags.xml (описания тегов) и Users.xml (имена авторов) - если есть.
+// Голоса переносятся как лайки: положительная оценка записи становится числом лайков.
+func ReadStackExchange(dir string) (ImportData, error) {
+	var data ImportData
+
+	users := make(map[string]ImportUser)
+	err := readSERows(filepath.Join(dir, "Users.xml"), func(u seUser) {
+		users[u.ID] = ImportUser{ID: u.ID, Username: u.DisplayName, CreatedAt: seTime(u.CreationDate)}
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return ImportData{}, err
+	}
+
+	// excerpts - теги по номеру записи с их кратким описанием
+	excerpts := make(map[string]int)
+	err = readSERows(filepath.Join(dir, "Tags.xml"), func(t seTag) {
+		if t.ExcerptPostID != "" {
+			excerpts[t.ExcerptPostID] = len(data.Tags)
+		}
+		data.Tags = append(data.Tags, ImportTag{Name: t.TagName})
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return ImportData{}, err
+	}
+
+	authors := make(map[string]bool)
+	author := func(p sePost) string {
+		id := p.OwnerUserID
+		u, ok := users[id]
+		if id == "" {
+			// автор удалил аккаунт, осталось только имя
+			id = "name:" + p.OwnerDisplayName
+			u, ok = ImportUser{ID: id, Username: p.OwnerDisplayName}, true
+		}
+		if !ok {
+			u = ImportUser{ID: id, Username: "user" + id}
+		}
+		if !authors[id] {
+			authors[id] = true
+			data.Users = append(data.Users, u)
+		}
+		return id
+	}
+
+	err = readSERows(filepath.Join(dir, "Posts.xml"), func(p sePost) {
+		switch p.PostTypeID {
+		case sePostQuestion:
+			text := strings.TrimSpace(p.Title)
+			if body := htmlText(p.Body); body != "" {
+				text += "\n\n" + body
+			}
+			closed := p.ClosedDate != ""
+			data.Questions = append(data.Questions, ImportQuestion{
+				ID:        p.ID,
+				UserID:    author(p),
+				Text:      text,
+				Tags:      seTags(p.Tags),
+				CreatedAt: seTime(p.CreationDate),
+				Closed:    &closed,
+				Likes:     max(p.Score, 0),
+			})
+		case sePostAnswer:
+			data.Answers = append(data.Answers, ImportAnswer{
+				ID:         p.ID,
+				QuestionID: p.ParentID,
+				UserID:     author(p),
+				Text:       htmlText(p.Body),
+				CreatedAt:  seTime(p.CreationDate),
+				Likes:      max(p.Score, 0),
+			})
+		case sePostTagExcerpt:
+			if i, ok := excerpts[p.ID]; ok {
+				data.Tags[i].Description = htmlText(p.Body)
+			}
+		}
+	})
+	if err != nil {
+		return ImportData{}, err
+	}
+	return data, nil
+}
+
+// readSERows вызывает fn для каждого элемента <row> файла path.
+func readSERows[T any](path string, fn func(row T)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var row T
+		if err := decoder.DecodeElement(&row, &start); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		fn(row)
+	}
+}
+
+// seTags разбирает теги записи: "<go><sql>" в старых выгрузках и "|go|sql|" в новых.
+func seTags(s string) []string {
+	return strings.FieldsFunc(s, func(c rune) bool {
+		return c == '<' || c == '>' || c == '|'
+	})
+}
+
+func seTime(s string) time.Time {
+	t, err := time.Parse(seTimeLayout, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+var (
+	htmlBreaks     = regexp.MustCompile(`(?i)<br\s*/?>|</(p|pre|li|h[1-6]|blockquote)>`)
+	htmlTags       = regexp.MustCompile(`<[^>]*>`)
+	htmlBlankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlText превращает HTML записи в простой текст: бот хранит вопросы и ответы без разметки.
+func htmlText(s string) string {
+	s = htmlBreaks.ReplaceAllString(s, "\n")
+	s = htmlTags.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = htmlBlankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,263 @@
+package bot_data
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Методы чтения базы вопросов для API и других клиентов помимо Telegram.
+
+// ErrNotFound - запрошенной записи нет или она недоступна.
+var ErrNotFound = errors.New("not found")
+
+// Порядок вопросов в QuestionFilter
+const (
+	OrderNewest = "new"
+	// OrderLikes - как в /questions: сначала самые залайканные
+	OrderLikes = "likes"
+	// OrderScore - по рейтингу, в котором учитываются и лайки, и ответы
+	OrderScore = "score"
+)
+
+// QuestionFilter - условия выборки вопросов. CommunityID 0 - общее пространство.
+type QuestionFilter struct {
+	CommunityID int64
+	Tag         string
+	// Query - строка поиска по тексту вопроса
+	Query      string
+	OpenOnly   bool
+	Unanswered bool
+	Order      string
+	Limit      int
+	Offset     int
+}
+
+type QuestionSummary struct {
+	ID          int64     `json:"id"`
+	Text        string    `json:"text"`
+	UserID      int64     `json:"user_id"`
+	Username    string    `json:"username"`
+	CreatedAt   time.Time `json:"created_at"`
+	Closed      bool      `json:"closed"`
+	Likes       int       `json:"likes"`
+	Answers     int       `json:"answers"`
+	Score       int       `json:"score"`
+	Tags        []string  `json:"tags"`
+	CommunityID int64     `json:"community_id,omitempty"`
+}
+
+type AnswerView struct {
+	ID        int64     `json:"id"`
+	Text      string    `json:"text"`
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	Likes     int       `json:"likes"`
+}
+
+type QuestionDetail struct {
+	QuestionSummary
+	AnswerList []AnswerView `json:"answer_list"`
+}
+
+type TagSummary struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Questions   int    `json:"questions"`
+	Unanswered  int    `json:"unanswered"`
+}
+
+type UserProfile struct {
+	ID           int64     `json:"id"`
+	Username     string    `json:"username"`
+	RegisteredAt time.Time `json:"registered_at"`
+	Status       string    `json:"status"`
+	Questions    int       `json:"questions"`
+	Answers      int       `json:"answers"`
+	Likes        int       `json:"likes"`
+}
+
+// questionSummarySelect - общая часть запросов списка и карточки вопроса.
+const questionSummarySelect = `
+	SELECT q.question_id, q.question_text, u.user_id, u.username, q.created_at, q.is_closed,
+		q.like_count, q.answer_count, q.score,
+		COALESCE((
+			SELECT array_agg(t.tag_name ORDER BY t.tag_name) FROM public.questiontags qt
+			JOIN public.tags t ON t.tag_id = qt.tag_id
+			WHERE qt.question_id = q.question_id
+		), '{}') AS tags,
+		COALESCE(q.community_id, 0)
+	FROM public.questions q
+	JOIN public.users u ON u.user_id = q.user_id
+`
+
+// RenderHTML размечает текст вопроса или ответа для веб-страницы: блоки кода
+// оформляются тегами pre и code, остальное экранируется.
+func RenderHTML(text string) string {
+	return string(content(htmlFormatter{}, text))
+}
+
+func scanQuestionSummary(row interface{ Scan(...interface{}) error }, q *QuestionSummary) error {
+	return row.Scan(&q.ID, &q.Text, &q.UserID, &q.Username, &q.CreatedAt, &q.Closed,
+		&q.Likes, &q.Answers, &q.Score, pq.Array(&q.Tags), &q.CommunityID)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListQuestions возвращает страницу вопросов и их общее количество. Со строкой
+// поиска вопросы упорядочены по похожести на запрос, без неё - по f.Order.
+func (b *Bot) ListQuestions(f QuestionFilter) ([]QuestionSummary, int, error) {
+	args := []interface{}{communityArg(f.CommunityID)}
+	where := []string{communityFilter("q.community_id", 1), "q.deleted_at IS NULL"}
+	order := "q.created_at DESC, q.question_id DESC"
+	switch f.Order {
+	case OrderLikes:
+		order = "q.like_count DESC, q.question_id DESC"
+	case OrderScore:
+		order = "q.score DESC, q.question_id DESC"
+	}
+	if f.OpenOnly {
+		where = append(where, "q.is_closed = false")
+	}
+	if f.Unanswered {
+		where = append(where, "q.answer_count = 0")
+	}
+
+	if f.Tag != "" {
+		args = append(args, b.canonicalTag(f.Tag))
+		where = append(where, `EXISTS (
+			SELECT 1 FROM public.questiontags qt
+			JOIN public.tags t ON t.tag_id = qt.tag_id
+			WHERE qt.question_id = q.question_id AND t.tag_name = $`+strconv.Itoa(len(args))+`)`)
+	}
+	if f.Query != "" {
+		args = append(args, f.Query, "%"+likeEscaper.Replace(f.Query)+"%", similarityThreshold)
+		n := len(args)
+		where = append(where, "(q.question_text ILIKE $"+strconv.Itoa(n-1)+` ESCAPE '\'`+
+			" OR similarity(q.question_text, $"+strconv.Itoa(n-2)+") >= $"+strconv.Itoa(n)+")")
+		order = "similarity(q.question_text, $" + strconv.Itoa(n-2) + ") DESC, q.question_id DESC"
+	}
+	condition := strings.Join(where, " AND ")
+
+	var total int
+	if err := b.dtbase.Db.QueryRow("SELECT COUNT(*) FROM public.questions q WHERE "+condition+";", args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, f.Limit, f.Offset)
+	query := questionSummarySelect + " WHERE " + condition + " ORDER BY " + order +
+		" LIMIT $" + strconv.Itoa(len(args)-1) + " OFFSET $" + strconv.Itoa(len(args)) + ";"
+	rows, err := b.dtbase.Db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	result := []QuestionSummary{}
+	for rows.Next() {
+		var q QuestionSummary
+		if err := scanQuestionSummary(rows, &q); err != nil {
+			return nil, 0, err
+		}
+		result = append(result, q)
+	}
+	return result, total, rows.Err()
+}
+
+// Question возвращает вопрос сообщества вместе с ответами.
+func (b *Bot) Question(communityID, questionID int64) (QuestionDetail, error) {
+	var d QuestionDetail
+	query := questionSummarySelect + " WHERE q.question_id = $1 AND q.deleted_at IS NULL AND " + communityFilter("q.community_id", 2) + ";"
+	err := scanQuestionSummary(b.dtbase.Db.QueryRow(query, questionID, communityArg(communityID)), &d.QuestionSummary)
+	if err == sql.ErrNoRows {
+		return d, ErrNotFound
+	}
+	if err != nil {
+		return d, err
+	}
+
+	answers, err := b.questionAnswers(questionID)
+	if err != nil {
+		return d, err
+	}
+	d.AnswerList = make([]AnswerView, 0, len(answers))
+	for _, a := range answers {
+		d.AnswerList = append(d.AnswerList, AnswerView{
+			ID:        a.ID,
+			Text:      a.Text,
+			UserID:    a.UserID,
+			Username:  a.Username,
+			Status:    a.Status,
+			CreatedAt: a.CreatedAt,
+			Likes:     a.Likes,
+		})
+	}
+	return d, nil
+}
+
+// ListTags возвращает страницу тегов сообщества по алфавиту и их общее количество.
+func (b *Bot) ListTags(communityID int64, limit, offset int) ([]TagSummary, int, error) {
+	query := `
+		SELECT t.tag_name, t.description,
+			COUNT(q.question_id) AS question_count,
+			COUNT(q.question_id) FILTER (WHERE q.answer_count = 0) AS unanswered_count,
+			COUNT(*) OVER () AS total
+		FROM public.tags t
+		LEFT JOIN public.questiontags qt ON qt.tag_id = t.tag_id
+		LEFT JOIN public.questions q ON q.question_id = qt.question_id AND q.deleted_at IS NULL AND ` + communityFilter("q.community_id", 3) + `
+		GROUP BY t.tag_id, t.tag_name, t.description
+		HAVING COUNT(q.question_id) > 0
+		ORDER BY t.tag_name
+		LIMIT $1 OFFSET $2;
+	`
+	rows, err := b.dtbase.Db.Query(query, limit, offset, communityArg(communityID))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	total := 0
+	result := []TagSummary{}
+	for rows.Next() {
+		var t TagSummary
+		if err := rows.Scan(&t.Name, &t.Description, &t.Questions, &t.Unanswered, &total); err != nil {
+			return nil, 0, err
+		}
+		result = append(result, t)
+	}
+	return result, total, rows.Err()
+}
+
+// UserProfile возвращает профиль пользователя со статистикой по сообществу
+// communityID: вопросы и ответы в других сообществах не учитываются.
+func (b *Bot) UserProfile(communityID, userID int64) (UserProfile, error) {
+	query := `
+		WITH user_questions AS (
+			SELECT q.like_count FROM public.questions q
+			WHERE q.user_id = $1 AND q.deleted_at IS NULL AND ` + communityFilter("q.community_id", 2) + `
+		), user_answers AS (
+			SELECT a.like_count FROM public.answers a
+			JOIN public.questions q ON q.question_id = a.question_id
+			WHERE a.user_id = $1 AND q.deleted_at IS NULL AND ` + communityFilter("q.community_id", 2) + `
+		)
+		SELECT u.user_id, u.username, u.registration_date, s.status_name,
+			(SELECT COUNT(*) FROM user_questions),
+			(SELECT COUNT(*) FROM user_answers),
+			(SELECT COALESCE(SUM(like_count), 0) FROM user_questions) + (SELECT COALESCE(SUM(like_count), 0) FROM user_answers)
+		FROM public.users u
+		JOIN public.statuses s ON s.status_id = u.status_id
+		WHERE u.user_id = $1;
+	`
+	var p UserProfile
+	err := b.dtbase.Db.QueryRow(query, userID, communityArg(communityID)).Scan(&p.ID, &p.Username, &p.RegisteredAt, &p.Status, &p.Questions, &p.Answers, &p.Likes)
+	if err == sql.ErrNoRows {
+		return p, ErrNotFound
+	}
+	return p, err
+}
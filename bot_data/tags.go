@@ -0,0 +1,375 @@
+package bot_data
+
+import (
+	"QADots/database"
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// maxTagLength - максимальная длина тега в символах
+const maxTagLength = database.MaxTagLength
+
+// normalizeTag приводит тег к каноническому виду: без пробелов по краям,
+// без ведущих '#', в нижнем регистре. Пустые и слишком длинные теги отбрасываются.
+func normalizeTag(tag string) string {
+	tag = strings.TrimSpace(tag)
+	tag = strings.TrimLeft(tag, "#")
+	tag = strings.ToLower(tag)
+	if utf8.RuneCountInString(tag) > maxTagLength {
+		return ""
+	}
+	return tag
+}
+
+// checkTags проверяет теги, которые ввёл пользователь: о слишком длинном теге
+// нужно сообщить, а не молча его отбросить, как это делает normalizeTag.
+func checkTags(tags ...string) error {
+	for _, tag := range tags {
+		if utf8.RuneCountInString(strings.TrimLeft(strings.TrimSpace(tag), "#")) > maxTagLength {
+			return newError("tag_too_long", tag, maxTagLength)
+		}
+	}
+	return nil
+}
+
+// canonicalTag нормализует тег и заменяет синоним на основной тег.
+func (b *Bot) canonicalTag(tag string) string {
+	return canonicalTagIn(b.dtbase.Db, tag)
+}
+
+// canonicalTagIn - canonicalTag, который читает синонимы через q, например внутри транзакции.
+func canonicalTagIn(q dbtx, tag string) string {
+	tag = normalizeTag(tag)
+	if tag == "" {
+		return ""
+	}
+	query := `
+		SELECT t.tag_name
+		FROM public.tagsynonyms s
+		JOIN public.tags t ON s.tag_id = t.tag_id
+		WHERE s.alias = $1;
+	`
+	var canonical string
+	err := q.QueryRow(query, tag).Scan(&canonical)
+	if err != nil {
+		return tag
+	}
+	return canonical
+}
+
+// canonicalTags возвращает список уникальных канонических тегов без пустых значений.
+func (b *Bot) canonicalTags(tags []string) []string {
+	return canonicalTagsIn(b.dtbase.Db, tags)
+}
+
+func canonicalTagsIn(q dbtx, tags []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, tag := range tags {
+		tag = canonicalTagIn(q, tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// inIDList проверяет, есть ли userID в списке идентификаторов через запятую.
+func inIDList(list string, userID int64) bool {
+	for _, id := range strings.Split(list, ",") {
+		listID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err == nil && listID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func isAdmin(userID int64) bool {
+	return inIDList(*Admins, userID)
+}
+
+// isModerator - администраторы тоже считаются модераторами.
+func isModerator(userID int64) bool {
+	return isAdmin(userID) || inIDList(*Moderators, userID)
+}
+
+func (b *Bot) tagID(name string) int {
+	tag_id := 0
+	b.dtbase.Db.QueryRow("SELECT tag_id FROM public.tags WHERE tag_name = $1;", name).Scan(&tag_id)
+	return tag_id
+}
+
+// Merge_Tags переносит все вопросы и подписки с тега args[0] на тег args[1],
+// удаляет первый тег и запоминает его как синоним второго.
+func (b *Bot) Merge_Tags(u *tgbotapi.User, args []string) string {
+	if !isAdmin(u.ID) {
+		return b.T(u.ID, "admins_only")
+	}
+	from, to, err := b.MergeTags(u.ID, args[0], args[1])
+	if _, ok := err.(i18nError); ok {
+		return b.ErrorText(u.ID, err)
+	}
+	if err != nil {
+		log.Printf("Ошибка при объединении тегов: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	return b.T(u.ID, "tags_merged", from, to)
+}
+
+// MergeTags объединяет тег from с тегом to от имени actorID и возвращает
+// нормализованные имена тегов.
+func (b *Bot) MergeTags(actorID int64, from, to string) (string, string, error) {
+	if err := checkTags(from, to); err != nil {
+		return from, to, err
+	}
+	from, to = normalizeTag(from), b.canonicalTag(to)
+	if from == "" || to == "" || from == to {
+		return from, to, newError("bad_arguments")
+	}
+	fromID, toID := b.tagID(from), b.tagID(to)
+	if fromID == 0 || toID == 0 {
+		return from, to, newError("tag_not_found")
+	}
+
+	queries := []string{
+		`INSERT INTO public.questiontags (question_id, tag_id)
+		SELECT question_id, $2 FROM public.questiontags WHERE tag_id = $1
+		ON CONFLICT DO NOTHING;`,
+		`INSERT INTO public.tagsubscriptions (user_id, tag_id)
+		SELECT user_id, $2 FROM public.tagsubscriptions WHERE tag_id = $1
+		ON CONFLICT DO NOTHING;`,
+		`UPDATE public.tagsynonyms SET tag_id = $2 WHERE tag_id = $1;`,
+		`DELETE FROM public.questiontags WHERE tag_id = $1;`,
+		`DELETE FROM public.tagsubscriptions WHERE tag_id = $1;`,
+		`DELETE FROM public.tags WHERE tag_id = $1;`,
+	}
+	err := b.inTx(func(tx *sql.Tx) error {
+		for _, query := range queries {
+			if _, err := tx.Exec(query, fromID, toID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`
+			INSERT INTO public.tagsynonyms (alias, tag_id) VALUES ($1, $2)
+			ON CONFLICT (alias) DO UPDATE SET tag_id = EXCLUDED.tag_id;
+		`, from, toID)
+		if err != nil {
+			return err
+		}
+		return audit(tx, actorID, AuditTagMerge, auditTargetTag, from,
+			map[string]interface{}{"tag": from, "tag_id": fromID},
+			map[string]interface{}{"tag": to, "tag_id": toID})
+	})
+	if err != nil {
+		return from, to, err
+	}
+	b.invalidateListings()
+	return from, to, nil
+}
+
+// Tag_Synonym добавляет синоним args[0] для существующего тега args[1].
+func (b *Bot) Tag_Synonym(u *tgbotapi.User, args []string) string {
+	if !isAdmin(u.ID) {
+		return b.T(u.ID, "admins_only")
+	}
+	if err := checkTags(args...); err != nil {
+		return b.ErrorText(u.ID, err)
+	}
+	alias, tag := normalizeTag(args[0]), b.canonicalTag(args[1])
+	if alias == "" || tag == "" || alias == tag {
+		return b.T(u.ID, "bad_arguments")
+	}
+	if b.tagID(alias) != 0 {
+		return b.T(u.ID, "tag_exists_use_merge", alias)
+	}
+	tag_id := b.tagID(tag)
+	if tag_id == 0 {
+		return b.T(u.ID, "tag_not_found")
+	}
+	err := b.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO public.tagsynonyms (alias, tag_id) VALUES ($1, $2)
+			ON CONFLICT (alias) DO UPDATE SET tag_id = EXCLUDED.tag_id;
+		`, alias, tag_id)
+		if err != nil {
+			return err
+		}
+		return audit(tx, u.ID, AuditTagSynonym, auditTargetTag, tag, nil, map[string]string{"alias": alias})
+	})
+	if err != nil {
+		log.Printf("Ошибка при добавлении синонима: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	return b.T(u.ID, "synonym_added", alias, tag)
+}
+
+const (
+	// tagsPageSize - количество тегов на одной странице /tags
+	tagsPageSize = 20
+	// excerptLength - длина отрывка описания тега в списке
+	excerptLength = 60
+)
+
+// tagsOrders задаёт допустимые сортировки для /tags.
+var tagsOrders = map[string]string{
+	"name":       "t.tag_name ASC",
+	"questions":  "question_count DESC, t.tag_name ASC",
+	"unanswered": "unanswered_count DESC, t.tag_name ASC",
+}
+
+func excerpt(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= length {
+		return text
+	}
+	return string([]rune(text)[:length]) + "…"
+}
+
+// Tags выводит каталог тегов: args[0] - сортировка (name, questions, unanswered), args[1] - номер страницы.
+func (b *Bot) Tags(u *tgbotapi.User, chat *tgbotapi.Chat, args []string) string {
+	order := "questions"
+	page := 1
+	for _, arg := range args {
+		if arg == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(arg); err == nil {
+			page = n
+			continue
+		}
+		if _, ok := tagsOrders[arg]; !ok {
+			return b.T(u.ID, "tags_bad_order")
+		}
+		order = arg
+	}
+	if page < 1 {
+		return b.T(u.ID, "tags_bad_page")
+	}
+
+	query := `
+		SELECT t.tag_name, t.description,
+			COUNT(q.question_id) AS question_count,
+			COUNT(q.question_id) FILTER (WHERE q.answer_count = 0) AS unanswered_count,
+			COUNT(*) OVER () AS total
+		FROM public.tags t
+		LEFT JOIN public.questiontags qt ON qt.tag_id = t.tag_id
+		LEFT JOIN public.questions q ON q.question_id = qt.question_id AND q.deleted_at IS NULL AND ` + communityFilter("q.community_id", 3) + `
+		GROUP BY t.tag_id, t.tag_name, t.description
+		HAVING COUNT(q.question_id) > 0
+		ORDER BY ` + tagsOrders[order] + `
+		LIMIT $1 OFFSET $2;
+	`
+	s := b.settings(u.ID)
+	rows, err := b.dtbase.Db.Query(query, tagsPageSize, (page-1)*tagsPageSize, communityArg(b.scope(u.ID, chat)))
+	if err != nil {
+		log.Printf("Ошибка при получении списка тегов: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	defer rows.Close()
+
+	locale := s.Locale
+	total := 0
+	var result string
+	for rows.Next() {
+		var tag struct {
+			name        string
+			description string
+			questions   int
+			unanswered  int
+		}
+		err := rows.Scan(&tag.name, &tag.description, &tag.questions, &tag.unanswered, &total)
+		if err != nil {
+			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
+		}
+		result += tr(locale, "tags_entry", tag.name, tag.questions, tag.unanswered)
+		if tag.description != "" {
+			result += "    " + excerpt(tag.description, excerptLength) + "\n"
+		}
+	}
+
+	if result == "" {
+		return tr(locale, "tags_empty")
+	}
+	pages := (total + tagsPageSize - 1) / tagsPageSize
+	result += tr(locale, "tags_page", page, pages)
+	if page < pages {
+		result += tr(locale, "tags_next", order, page+1)
+	}
+	return result
+}
+
+// Tag показывает описание тега и его статистику.
+func (b *Bot) Tag(u *tgbotapi.User, chat *tgbotapi.Chat, arg string) Reply {
+	name := b.canonicalTag(arg)
+	query := `
+		SELECT t.description,
+			COUNT(q.question_id) AS question_count,
+			COUNT(q.question_id) FILTER (WHERE q.answer_count = 0) AS unanswered_count
+		FROM public.tags t
+		LEFT JOIN public.questiontags qt ON qt.tag_id = t.tag_id
+		LEFT JOIN public.questions q ON q.question_id = qt.question_id AND q.deleted_at IS NULL AND ` + communityFilter("q.community_id", 2) + `
+		WHERE t.tag_name = $1
+		GROUP BY t.tag_id, t.description;
+	`
+	s := b.settings(u.ID)
+	var description string
+	var questions, unanswered int
+	err := b.dtbase.Db.QueryRow(query, name, communityArg(b.scope(u.ID, chat))).Scan(&description, &questions, &unanswered)
+	if err != nil {
+		return Text(b.T(u.ID, "tag_not_found"))
+	}
+
+	f := b.format
+	locale := s.Locale
+	result := trf(f, locale, "tag_info", Markup(f.Bold(name)), questions, unanswered)
+	if description == "" {
+		result += trf(f, locale, "tag_no_description")
+	} else {
+		result += string(content(f, description))
+	}
+	return Reply{Records: []string{result}, Format: f}
+}
+
+// Tag_Description задаёт описание тега. Доступно модераторам.
+func (b *Bot) Tag_Description(u *tgbotapi.User, args []string) string {
+	if !isModerator(u.ID) {
+		return b.T(u.ID, "moderators_only")
+	}
+	name := b.canonicalTag(args[0])
+	description := strings.TrimSpace(args[1])
+
+	found := false
+	err := b.inTx(func(tx *sql.Tx) error {
+		var old string
+		err := tx.QueryRow("SELECT description FROM public.tags WHERE tag_name = $1 FOR UPDATE;", name).Scan(&old)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		if _, err := tx.Exec("UPDATE public.tags SET description = $2 WHERE tag_name = $1;", name, description); err != nil {
+			return err
+		}
+		return audit(tx, u.ID, AuditTagDescription, auditTargetTag, name,
+			map[string]string{"description": old}, map[string]string{"description": description})
+	})
+	if err != nil {
+		log.Printf("Ошибка при обновлении описания тега: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	if !found {
+		return b.T(u.ID, "tag_not_found")
+	}
+	return b.T(u.ID, "tag_description_update", name)
+}
@@ -0,0 +1,162 @@
+package bot_data
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMergeTags(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice := testUser(1, "alice")
+		b.Start(alice)
+		ask(t, b, alice, "Как читать файл построчно? #Go")
+		ask(t, b, alice, "Что такое горутина? ~ golang")
+
+		from, to, err := b.MergeTags(alice.ID, "#golang", "GO")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if from != "golang" || to != "go" {
+			t.Fatalf("объединены %q и %q", from, to)
+		}
+		if tag := b.canonicalTag("golang"); tag != "go" {
+			t.Errorf("golang стал синонимом %q", tag)
+		}
+
+		// тег без вопросов в список не попадает
+		if _, err := b.dtbase.Db.Exec("INSERT INTO public.tags (tag_name) VALUES ('empty');"); err != nil {
+			t.Fatal(err)
+		}
+		tags, total, err := b.ListTags(0, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 1 || len(tags) != 1 || tags[0].Name != "go" || tags[0].Questions != 2 {
+			t.Fatalf("теги после объединения: %d, %+v", total, tags)
+		}
+
+		if list := b.Tags(alice, nil, nil); strings.Contains(list, "empty") || !strings.Contains(list, "go") {
+			t.Errorf("/tags: %q", list)
+		}
+
+		// новый вопрос с синонимом попадает в основной тег
+		ask(t, b, alice, "Как закрыть канал? #golang")
+		questions, err := b.questionsByTag(0, "go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(questions) != 3 {
+			t.Errorf("вопросов с тегом go: %d, ожидалось 3", len(questions))
+		}
+	})
+}
+
+func TestMergeTagsTooLong(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		long := strings.Repeat("x", maxTagLength+1)
+		if _, _, err := b.MergeTags(1, long, "go"); errorKey(err) != "tag_too_long" {
+			t.Errorf("ошибка %v, ожидалась tag_too_long", err)
+		}
+	})
+}
+
+// TestNormalizeTagsMigration проверяет, что миграции приводят к каноническому виду
+// теги, записанные до нормализации, и объединяют совпавшие.
+func TestNormalizeTagsMigration(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		alice := testUser(1, "alice")
+		b.Start(alice)
+		q1 := ask(t, b, alice, "Как собрать бинарник под ARM? ~ go")
+		q2 := ask(t, b, alice, "Чем LEFT JOIN отличается от INNER? ~ sql")
+
+		db := b.dtbase.Db
+		exec := func(query string, args ...interface{}) {
+			t.Helper()
+			if _, err := db.Exec(query, args...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tagID := func(name string) (id int64) {
+			t.Helper()
+			if err := db.QueryRow("SELECT tag_id FROM public.tags WHERE tag_name = $1;", name).Scan(&id); err != nil {
+				t.Fatalf("тег %s: %v", name, err)
+			}
+			return id
+		}
+		// так теги выглядели до нормализации
+		exec("INSERT INTO public.tags (tag_name, description) VALUES ('#Go', ''), ('GO', 'Язык Go'), ('Постгрес', 'СУБД'), ('#SQL', '');")
+		exec("INSERT INTO public.questiontags (question_id, tag_id) VALUES ($1, $2), ($3, $4), ($3, $5);", q2, tagID("#Go"), q1, tagID("GO"), tagID("Постгрес"))
+		exec("INSERT INTO public.tagsubscriptions (user_id, tag_id) VALUES ($1, $2), ($1, $3);", alice.ID, tagID("GO"), tagID("#SQL"))
+		exec("INSERT INTO public.tagsynonyms (alias, tag_id) VALUES ('golang', $1);", tagID("#Go"))
+		// пустые теги из двойных пробелов и тег длиннее ограничения
+		long := "Kubernetes-Operator-Lifecycle-Management"
+		exec("INSERT INTO public.tags (tag_name, description) VALUES ('', ''), ('  ', ''), ('#', ''), ($1, '');", long)
+		exec("INSERT INTO public.questiontags (question_id, tag_id) VALUES ($1, $2), ($1, $3), ($4, $5);", q1, tagID(""), tagID("  "), q2, tagID(long))
+		exec("INSERT INTO public.tagsubscriptions (user_id, tag_id) VALUES ($1, $2);", alice.ID, tagID("#"))
+		exec("INSERT INTO public.tagsynonyms (alias, tag_id) VALUES ('пусто', $1);", tagID("  "))
+
+		for i := 0; i < 2; i++ {
+			if err := b.dtbase.Migrate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		rows, err := db.Query("SELECT tag_name, description FROM public.tags ORDER BY tag_name;")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags := map[string]string{}
+		for rows.Next() {
+			var name, description string
+			if err := rows.Scan(&name, &description); err != nil {
+				t.Fatal(err)
+			}
+			tags[name] = description
+		}
+		rows.Close()
+		truncated := strings.ToLower(long)[:maxTagLength]
+		want := map[string]string{"go": "", "sql": "", "постгрес": "СУБД", truncated: ""}
+		if len(tags) != len(want) {
+			t.Fatalf("теги после миграции: %v", tags)
+		}
+		for name, description := range want {
+			if got, ok := tags[name]; !ok || got != description {
+				t.Errorf("тег %s: %q, %v", name, got, ok)
+			}
+		}
+
+		q, err := b.Question(0, q1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(q.Tags, []string{"go", "постгрес"}) {
+			t.Errorf("теги первого вопроса: %v", q.Tags)
+		}
+		if q, _ = b.Question(0, q2); !slices.Equal(q.Tags, []string{"go", truncated, "sql"}) {
+			t.Errorf("теги второго вопроса: %v", q.Tags)
+		}
+		var subscriptions int
+		if err := db.QueryRow("SELECT COUNT(*) FROM public.tagsubscriptions WHERE user_id = $1 AND tag_id IN ($2, $3);", alice.ID, tagID("go"), tagID("sql")).Scan(&subscriptions); err != nil {
+			t.Fatal(err)
+		}
+		if subscriptions != 2 {
+			t.Errorf("подписок после миграции: %d", subscriptions)
+		}
+		var links int
+		query := `
+			SELECT (SELECT COUNT(*) FROM public.questiontags) + (SELECT COUNT(*) FROM public.tagsubscriptions) +
+				(SELECT COUNT(*) FROM public.tagsynonyms);
+		`
+		if err := db.QueryRow(query).Scan(&links); err != nil {
+			t.Fatal(err)
+		}
+		// 5 тегов у вопросов, 2 подписки и синоним golang
+		if links != 8 {
+			t.Errorf("связей с тегами после миграции: %d, ожидалось 8", links)
+		}
+		if tag := b.canonicalTag("golang"); tag != "go" {
+			t.Errorf("синоним golang указывает на %q", tag)
+		}
+	})
+}
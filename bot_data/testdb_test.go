@@ -0,0 +1,116 @@
+package bot_data
+
+import (
+	"QADots/database"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// testPostgresEnv - переменная окружения со строкой подключения к Postgres.
+// Тесты хранилища всегда выполняются на SQLite, а на Postgres - только если она
+// задана. База должна содержать основную схему бота; все данные в ней удаляются.
+const testPostgresEnv = "QADOTS_TEST_POSTGRES"
+
+func testDrivers() []string {
+	drivers := []string{database.DriverSQLite}
+	if os.Getenv(testPostgresEnv) != "" {
+		drivers = append(drivers, database.DriverPostgres)
+	}
+	return drivers
+}
+
+// forEachDriver выполняет fn на новой пустой базе каждого доступного драйвера.
+func forEachDriver(t *testing.T, fn func(t *testing.T, b *Bot)) {
+	for _, driver := range testDrivers() {
+		t.Run(driver, func(t *testing.T) {
+			fn(t, newTestBot(t, driver))
+		})
+	}
+}
+
+// newTestBot подключает бота без Telegram к пустой базе драйвера driver.
+func newTestBot(t *testing.T, driver string) *Bot {
+	t.Helper()
+	source := os.Getenv(testPostgresEnv)
+	if driver == database.DriverSQLite {
+		source = filepath.Join(t.TempDir(), "bot.db")
+	}
+	db, err := database.Open(driver, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Db.Close() })
+	if err := db.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if driver == database.DriverPostgres {
+		truncateAll(t, db)
+	}
+
+	format, _ := LookupFormatter("html")
+	return &Bot{
+		dtbase:  db,
+		format:  format,
+		pending: make(map[int64]pendingQuestion),
+		cache:   newCaches(*CacheSize, *CacheTTL),
+	}
+}
+
+// truncateAll очищает таблицы бота в Postgres, где база общая для всех тестов.
+func truncateAll(t *testing.T, db *database.DB) {
+	t.Helper()
+	tables := []string{"public.outbox", "public.webhookdeliveries"}
+	for _, table := range backupTables {
+		if table.conflict == "" {
+			tables = append(tables, "public."+table.name)
+		}
+	}
+	if _, err := db.Db.Exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE;"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testUser(id int64, name string) *tgbotapi.User {
+	return &tgbotapi.User{ID: id, UserName: name, FirstName: name}
+}
+
+// expect сравнивает ответ бота с сообщением key на языке по умолчанию.
+func expect(t *testing.T, got, key string, args ...interface{}) {
+	t.Helper()
+	if want := tr(defaultLocale, key, args...); got != want {
+		t.Fatalf("ответ %q, ожидался %q (%s)", got, want, key)
+	}
+}
+
+// ask задаёт вопрос и возвращает его номер.
+func ask(t *testing.T, b *Bot, u *tgbotapi.User, text string) int64 {
+	t.Helper()
+	r := b.Ask(u, nil, text, nil)
+	if len(r.Records) != 1 {
+		t.Fatalf("ответ на /ask: %v", r.Records)
+	}
+	expect(t, r.Records[0], "question_added")
+	var id int64
+	err := b.dtbase.Db.QueryRow("SELECT MAX(question_id) FROM public.questions WHERE user_id = $1;", u.ID).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// answer отвечает на вопрос и возвращает номер ответа.
+func answer(t *testing.T, b *Bot, u *tgbotapi.User, questionID int64, text string) int64 {
+	t.Helper()
+	expect(t, b.Answer(u, []string{strconv.FormatInt(questionID, 10), text}, nil), "answer_added")
+	var id int64
+	err := b.dtbase.Db.QueryRow("SELECT MAX(answer_id) FROM public.answers WHERE user_id = $1;", u.ID).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
@@ -0,0 +1,377 @@
+package bot_data
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+// События, о которых сообщают исходящие вебхуки
+const (
+	EventQuestionCreated = "question.created"
+	EventAnswerCreated   = "answer.created"
+	EventLikeAdded       = "like.added"
+	EventQuestionClosed  = "question.closed"
+)
+
+var webhookEvents = []string{EventQuestionCreated, EventAnswerCreated, EventLikeAdded, EventQuestionClosed}
+
+// Заголовки запроса вебхука
+const (
+	headerEvent     = "X-QADots-Event"
+	headerDelivery  = "X-QADots-Delivery"
+	headerSignature = "X-QADots-Signature"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+type webhook struct {
+	id     int64
+	url    string
+	secret string
+	events []string
+}
+
+// wants - пустой список событий означает подписку на все события.
+func (w webhook) wants(event string) bool {
+	if len(w.events) == 0 {
+		return true
+	}
+	for _, e := range w.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookPayload - тело запроса вебхука.
+type webhookPayload struct {
+	Delivery  int64       `json:"delivery"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type questionEvent struct {
+	QuestionID  int64    `json:"question_id"`
+	UserID      int64    `json:"user_id"`
+	Username    string   `json:"username"`
+	Text        string   `json:"text,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	CommunityID int64    `json:"community_id,omitempty"`
+}
+
+type answerEvent struct {
+	AnswerID   int64  `json:"answer_id"`
+	QuestionID int64  `json:"question_id"`
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username"`
+	Text       string `json:"text"`
+}
+
+type likeEvent struct {
+	// Target - question или answer
+	Target   string `json:"target"`
+	TargetID int64  `json:"target_id"`
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// sign - HMAC-SHA256 тела запроса с секретом вебхука.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// activeWebhooks - активные вебхуки сообщества community (0 - общего пространства).
+func activeWebhooks(q dbtx, community int64) []webhook {
+	query := "SELECT webhook_id, url, secret, events FROM public.webhooks WHERE active AND " +
+		communityFilter("community_id", 1) + " ORDER BY webhook_id;"
+	rows, err := q.Query(query, communityArg(community))
+	if err != nil {
+		log.Printf("Ошибка при получении вебхуков: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var result []webhook
+	for rows.Next() {
+		var w webhook
+		if err := rows.Scan(&w.id, &w.url, &w.secret, pq.Array(&w.events)); err != nil {
+			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
+		}
+		result = append(result, w)
+	}
+	return result
+}
+
+// webhookJob - событие для одного вебхука в outbox.
+type webhookJob struct {
+	WebhookID int64           `json:"webhook_id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// emit ставит событие в outbox для каждого подписанного вебхука сообщества community,
+// в котором находится вопрос события: вопросы закрытого сообщества не уходят
+// вебхукам других сообществ. key определяет событие (например, answer:12), чтобы
+// одно и то же событие не ушло дважды.
+func (b *Bot) emit(tx dbtx, community int64, event, key string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	for _, w := range activeWebhooks(tx, community) {
+		if !w.wants(event) {
+			continue
+		}
+		job := webhookJob{WebhookID: w.id, Event: event, CreatedAt: time.Now().UTC(), Data: raw}
+		if err := enqueue(tx, outboxWebhook, fmt.Sprintf("%s:%d:%s", event, w.id, key), job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverWebhook отправляет событие из outbox и записывает попытку в журнал доставок.
+// Номер записи outbox служит номером доставки: он не меняется между повторами,
+// и получатель может по нему отбрасывать дубликаты. Успехом считается любой ответ 2xx.
+func (b *Bot) deliverWebhook(id int64, job webhookJob) error {
+	var w webhook
+	err := b.dtbase.Db.QueryRow("SELECT webhook_id, url, secret FROM public.webhooks WHERE webhook_id = $1 AND active;", job.WebhookID).
+		Scan(&w.id, &w.url, &w.secret)
+	if err == sql.ErrNoRows {
+		// вебхук отключили, пока событие ждало отправки
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(webhookPayload{Delivery: id, Event: job.Event, CreatedAt: job.CreatedAt, Data: job.Data})
+	if err != nil {
+		return err
+	}
+	status, err := postWebhook(w, id, job.Event, body)
+	delivered := err == nil && status >= 200 && status < 300
+	if err == nil && !delivered {
+		err = fmt.Errorf("unexpected status %d", status)
+	}
+	errText := ""
+	if err != nil {
+		errText = err.Error()
+	}
+
+	query := `
+		INSERT INTO public.webhookdeliveries (webhook_id, outbox_id, event, payload, attempts, status_code, error, delivered_at)
+		VALUES ($1, $2, $3, $4, 1, $5, $6, CASE WHEN $7 THEN NOW() END)
+		ON CONFLICT (outbox_id) DO UPDATE SET
+			attempts = public.webhookdeliveries.attempts + 1,
+			status_code = EXCLUDED.status_code,
+			error = EXCLUDED.error,
+			delivered_at = EXCLUDED.delivered_at;
+	`
+	if _, logErr := b.dtbase.Db.Exec(query, w.id, id, job.Event, body, status, errText, delivered); logErr != nil {
+		log.Printf("Ошибка при записи доставки вебхука: %v", logErr)
+	}
+	return err
+}
+
+func postWebhook(w webhook, id int64, event string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerEvent, event)
+	req.Header.Set(headerDelivery, strconv.FormatInt(id, 10))
+	req.Header.Set(headerSignature, sign(w.secret, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Webhook_Add регистрирует исходящий вебхук активного сообщества администратора:
+// args[0] - адрес, дальше - события. Без событий вебхук получает все. Команда
+// работает только в личных сообщениях: в ответе есть секрет подписи.
+func (b *Bot) Webhook_Add(u *tgbotapi.User, chat *tgbotapi.Chat, args []string) string {
+	if !isAdmin(u.ID) {
+		return b.T(u.ID, "admins_only")
+	}
+	if IsGroup(chat) {
+		return b.T(u.ID, "webhook_private_only")
+	}
+	target, err := url.Parse(args[0])
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return b.T(u.ID, "webhook_bad_url")
+	}
+	events := args[1:]
+	for _, e := range events {
+		known := false
+		for _, k := range webhookEvents {
+			known = known || e == k
+		}
+		if !known {
+			return b.T(u.ID, "webhook_bad_event", strings.Join(webhookEvents, ", "))
+		}
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		log.Printf("Ошибка при создании секрета вебхука: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	query := `
+		INSERT INTO public.webhooks (url, secret, events, community_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING webhook_id;
+	`
+	community := b.scope(u.ID, chat)
+	var id int64
+	err = b.inTx(func(tx *sql.Tx) error {
+		if err := tx.QueryRow(query, target.String(), secret, pq.Array(events), communityArg(community)).Scan(&id); err != nil {
+			return err
+		}
+		// секрет в журнал не попадает
+		return audit(tx, u.ID, AuditWebhookAdd, auditTargetWebhook, id, nil, map[string]interface{}{"url": target.String(), "events": events, "community_id": community})
+	})
+	if err != nil {
+		log.Printf("Ошибка при добавлении вебхука: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	return b.T(u.ID, "webhook_added", id, secret)
+}
+
+// Webhook_Remove отключает вебхук. Журнал его доставок сохраняется.
+func (b *Bot) Webhook_Remove(u *tgbotapi.User, arg string) string {
+	if !isAdmin(u.ID) {
+		return b.T(u.ID, "admins_only")
+	}
+	found := false
+	err := b.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec("UPDATE public.webhooks SET active = false WHERE webhook_id = $1 AND active;", arg)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+		found = true
+		return audit(tx, u.ID, AuditWebhookRemove, auditTargetWebhook, arg, map[string]bool{"active": true}, map[string]bool{"active": false})
+	})
+	if err != nil {
+		log.Printf("Ошибка при отключении вебхука: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	if !found {
+		return b.T(u.ID, "webhook_not_found")
+	}
+	return b.T(u.ID, "webhook_removed", arg)
+}
+
+// Webhooks показывает активные вебхуки и результат их последних доставок.
+func (b *Bot) Webhooks(u *tgbotapi.User) string {
+	if !isAdmin(u.ID) {
+		return b.T(u.ID, "admins_only")
+	}
+	query := `
+		SELECT w.webhook_id, w.url, w.events, COALESCE(c.name, ''),
+			COUNT(d.delivery_id) FILTER (WHERE d.delivered_at IS NOT NULL),
+			COUNT(d.delivery_id) FILTER (WHERE d.delivered_at IS NULL)
+		FROM public.webhooks w
+		LEFT JOIN public.communities c ON c.community_id = w.community_id
+		LEFT JOIN public.webhookdeliveries d ON d.webhook_id = w.webhook_id
+		WHERE w.active
+		GROUP BY w.webhook_id, w.url, w.events, c.name
+		ORDER BY w.webhook_id;
+	`
+	rows, err := b.dtbase.Db.Query(query)
+	if err != nil {
+		log.Printf("Ошибка при получении вебхуков: %v", err)
+		return b.T(u.ID, "error_retry")
+	}
+	defer rows.Close()
+
+	locale := b.settings(u.ID).Locale
+	var result string
+	for rows.Next() {
+		var id int64
+		var target, community string
+		var events []string
+		var delivered, pending int
+		if err := rows.Scan(&id, &target, pq.Array(&events), &community, &delivered, &pending); err != nil {
+			log.Printf("Ошибка при сканировании строки: %v", err)
+			continue
+		}
+		list := strings.Join(events, ", ")
+		if list == "" {
+			list = "*"
+		}
+		if community == "" {
+			community = tr(locale, "community_global")
+		}
+		result += tr(locale, "webhook_entry", id, target, community, list, delivered, pending)
+	}
+	if result == "" {
+		return tr(locale, "webhooks_empty")
+	}
+	return result
+}
+
+// emitQuestionCreated читает только что созданный вопрос с тегами и сообщает о нём вебхукам.
+func (b *Bot) emitQuestionCreated(tx dbtx, u *tgbotapi.User, questionID int64, text string) error {
+	e := questionEvent{QuestionID: questionID, UserID: u.ID, Username: u.UserName, Text: text}
+	query := `
+		SELECT COALESCE(q.community_id, 0), COALESCE((
+			SELECT array_agg(t.tag_name ORDER BY t.tag_name) FROM public.questiontags qt
+			JOIN public.tags t ON t.tag_id = qt.tag_id
+			WHERE qt.question_id = q.question_id), '{}')
+		FROM public.questions q
+		WHERE q.question_id = $1;
+	`
+	if err := tx.QueryRow(query, questionID).Scan(&e.CommunityID, pq.Array(&e.Tags)); err != nil {
+		return err
+	}
+	return b.emit(tx, e.CommunityID, EventQuestionCreated, fmt.Sprintf("question:%d", questionID), e)
+}
+
+// questionCommunity - сообщество вопроса, 0 - общее пространство.
+func questionCommunity(q dbtx, questionID int64) (int64, error) {
+	var id int64
+	err := q.QueryRow("SELECT COALESCE(community_id, 0) FROM public.questions WHERE question_id = $1;", questionID).Scan(&id)
+	return id, err
+}
+
+func likeData(u *tgbotapi.User, target string, id int64) likeEvent {
+	return likeEvent{Target: target, TargetID: id, UserID: u.ID, Username: u.UserName}
+}
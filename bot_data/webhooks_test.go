@@ -0,0 +1,65 @@
+package bot_data
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/skinass/telegram-bot-api/v5"
+)
+
+func TestWebhookCommunities(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, b *Bot) {
+		admins := *Admins
+		*Admins = "1"
+		t.Cleanup(func() { *Admins = admins })
+
+		alice := testUser(1, "alice")
+		b.Start(alice)
+
+		// секрет подписи не отправляется в группу
+		group := &tgbotapi.Chat{ID: -100, Type: "group"}
+		expect(t, b.Webhook_Add(alice, group, []string{"https://example.com/hook"}), "webhook_private_only")
+
+		if reply := b.Webhook_Add(alice, nil, []string{"https://example.com/global"}); !strings.Contains(reply, "#1") {
+			t.Fatalf("ответ на /webhook_add: %q", reply)
+		}
+		b.Community_Create(alice, nil, "Команда")
+		if reply := b.Webhook_Add(alice, nil, []string{"https://example.com/team"}); !strings.Contains(reply, "#2") {
+			t.Fatalf("ответ на /webhook_add: %q", reply)
+		}
+		if list := b.Webhooks(alice); !strings.Contains(list, "Команда") {
+			t.Errorf("в списке вебхуков нет сообщества: %q", list)
+		}
+
+		private := ask(t, b, alice, "Где лежат ключи от стенда? #infra")
+		b.Community_Switch(alice, "0")
+		public := ask(t, b, alice, "Как устроен map? #go")
+
+		// вебхук получает только вопросы своего сообщества
+		rows, err := b.dtbase.Db.Query("SELECT payload FROM public.outbox WHERE kind = $1;", outboxWebhook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		got := map[int64]int64{}
+		for rows.Next() {
+			var payload []byte
+			if err := rows.Scan(&payload); err != nil {
+				t.Fatal(err)
+			}
+			var job webhookJob
+			var e questionEvent
+			if err := json.Unmarshal(payload, &job); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(job.Data, &e); err != nil {
+				t.Fatal(err)
+			}
+			got[e.QuestionID] = job.WebhookID
+		}
+		if len(got) != 2 || got[public] != 1 || got[private] != 2 {
+			t.Errorf("вебхуки вопросов: %v, ожидалось {%d: 1, %d: 2}", got, public, private)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+// Package cache - кэш горячих выборок бота.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache - хранилище значений с ограниченным временем жизни. LRU реализует его
+// в памяти процесса; общий для нескольких экземпляров бота кэш (например, во
+// внешнем хранилище) может реализовать тот же интерфейс.
+type Cache[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+	Delete(key K)
+	// Purge удаляет все значения
+	Purge()
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// LRU - кэш в памяти на size значений. Когда место заканчивается, вытесняется
+// значение, к которому дольше всего не обращались. Значения старше ttl не отдаются.
+type LRU[K comparable, V any] struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	order *list.List
+	items map[K]*list.Element
+}
+
+// New создаёт LRU. size меньше единицы отключает кэш: Get всегда промахивается.
+func New[K comparable, V any](size int, ttl time.Duration) *LRU[K, V] {
+	return &LRU[K, V]{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[K]*list.Element),
+	}
+}
+
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*entry[K, V])
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *LRU[K, V]) Set(key K, value V) {
+	if c.size < 1 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *LRU[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.items = make(map[K]*list.Element)
+}
+
+// Len возвращает число значений в кэше, включая ещё не удалённые устаревшие.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
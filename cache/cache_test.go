@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	c := New[string, int](2, time.Minute)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	// обращение к a делает вытесняемым b
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %d, %v", v, ok)
+	}
+	c.Set("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("b не вытеснен")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if v, ok := c.Get(key); !ok || v != want {
+			t.Errorf("Get(%s) = %d, %v", key, v, ok)
+		}
+	}
+
+	// повторный Set обновляет значение и не занимает места
+	c.Set("a", 10)
+	c.Set("a", 11)
+	if v, _ := c.Get("a"); v != 11 || c.Len() != 2 {
+		t.Errorf("после обновления: a = %d, Len = %d", v, c.Len())
+	}
+}
+
+func TestLRUDeleteAndPurge(t *testing.T) {
+	c := New[int, string](10, time.Minute)
+	c.Set(1, "x")
+	c.Set(2, "y")
+	c.Delete(1)
+	c.Delete(3)
+	if _, ok := c.Get(1); ok {
+		t.Error("1 не удалён")
+	}
+	if _, ok := c.Get(2); !ok {
+		t.Error("2 удалён вместе с 1")
+	}
+	c.Purge()
+	if _, ok := c.Get(2); ok || c.Len() != 0 {
+		t.Errorf("после Purge осталось %d значений", c.Len())
+	}
+	c.Set(4, "z")
+	if v, ok := c.Get(4); !ok || v != "z" {
+		t.Error("после Purge кэш не работает")
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	c := New[string, int](10, 20*time.Millisecond)
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("значение устарело сразу")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("устаревшее значение отдано")
+	}
+	if c.Len() != 0 {
+		t.Errorf("устаревшее значение не удалено при чтении: Len = %d", c.Len())
+	}
+
+	// Set продлевает жизнь значения
+	c.Set("b", 1)
+	time.Sleep(15 * time.Millisecond)
+	c.Set("b", 2)
+	time.Sleep(15 * time.Millisecond)
+	if v, ok := c.Get("b"); !ok || v != 2 {
+		t.Errorf("Get(b) = %d, %v", v, ok)
+	}
+}
+
+func TestLRUDisabled(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		c := New[string, int](size, time.Minute)
+		c.Set("a", 1)
+		if _, ok := c.Get("a"); ok || c.Len() != 0 {
+			t.Errorf("кэш размера %d хранит значения", size)
+		}
+	}
+}
+
+func TestLRUConcurrent(t *testing.T) {
+	const size = 50
+	c := New[int, string](size, time.Minute)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := (g*1000 + i) % 80
+				c.Set(key, strconv.Itoa(key))
+				if v, ok := c.Get(key); ok && v != strconv.Itoa(key) {
+					t.Errorf("Get(%d) = %q", key, v)
+				}
+				if i%10 == 0 {
+					c.Delete(key)
+				}
+				if i%500 == 0 {
+					c.Purge()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if c.Len() > size {
+		t.Errorf("в кэше %d значений при размере %d", c.Len(), size)
+	}
+}
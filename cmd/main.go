@@ -1,17 +1,20 @@
 package main
 
 import (
+	"QADots/api"
 	"QADots/bot_data"
+	"QADots/database"
+	"QADots/feeds"
+	"QADots/web"
 	"context"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -40,16 +43,145 @@ var (
 	Port = ":8080"
 )
 
-func ParseMessageCommand(cmd string, sent string) ([]string, error) {
-	stringList := strings.Split(cmd, sent)
-	return stringList, nil
+// handleCommand разбирает команду из сообщения и формирует ответ на неё
+func handleCommand(b *bot_data.Bot, m *tgbotapi.Message) bot_data.Reply {
+	cmd := m.Command()
+	spec, ok := bot_data.LookupCommand(cmd)
+	if !ok {
+		return bot_data.Text(b.T(m.From.ID, "unknown_command"))
+	}
+	args, err := spec.Parse(m.CommandArguments())
+	if err != nil {
+		return bot_data.Text(b.ErrorText(m.From.ID, err))
+	}
+
+	var reply bot_data.Reply
+	switch cmd {
+	case "help":
+		log.Printf("print help")
+		reply = bot_data.Text(b.Help(m.From))
+		// обычная клавиатура в группе появилась бы у всех участников
+		if m.Chat.IsPrivate() {
+			reply.Markup = helperKeyboard
+		}
+
+	case "start":
+		reply = bot_data.Text(b.Start(m.From))
+
+	case "ask":
+		reply = b.Ask(m.From, m.Chat, args[0], bot_data.MessageAttachments(m))
+
+	case "answer":
+		reply = bot_data.Text(b.Answer(m.From, args, bot_data.MessageAttachments(m)))
+
+	case "questions":
+		reply = b.Questions(m.From, m.Chat, args[0])
+
+	case "my_questions":
+		reply = b.My_Questions(m.From, m.Chat)
+
+	case "like_question":
+		reply = bot_data.Text(b.Like_Question(m.From, args[0]))
+
+	case "like_answer":
+		reply = bot_data.Text(b.Like_Answer(m.From, args[0]))
+
+	case "close":
+		reply = bot_data.Text(b.Close(m.From, args[0]))
+
+	case "get_answers":
+		reply = b.Get_Answers(m.From, args[0])
+
+	case "export":
+		reply = b.Export(m.From, m.Chat, args)
+
+	case "subscribe":
+		reply = bot_data.Text(b.Subscribe(m.From, args[0]))
+
+	case "unsubscribe":
+		reply = bot_data.Text(b.Unsubscribe(m.From, args[0]))
+
+	case "digest":
+		reply = bot_data.Text(b.Digest(m.From, args[0]))
+
+	case "settings":
+		reply = b.Settings(m.From, args)
+
+	case "chat_mode":
+		reply = bot_data.Text(b.Chat_Mode(m.From, m.Chat, args))
+
+	case "community":
+		reply = bot_data.Text(b.Communities(m.From, m.Chat))
+
+	case "community_create":
+		reply = bot_data.Text(b.Community_Create(m.From, m.Chat, args[0]))
+
+	case "community_join":
+		reply = bot_data.Text(b.Community_Join(m.From, args[0]))
+
+	case "community_switch":
+		reply = bot_data.Text(b.Community_Switch(m.From, args[0]))
+
+	case "community_leave":
+		reply = bot_data.Text(b.Community_Leave(m.From, args[0]))
+
+	case "tags":
+		reply = bot_data.Text(b.Tags(m.From, m.Chat, args))
+
+	case "tag":
+		reply = b.Tag(m.From, m.Chat, args[0])
+
+	case "tag_description":
+		reply = bot_data.Text(b.Tag_Description(m.From, args))
+
+	case "merge_tags":
+		reply = bot_data.Text(b.Merge_Tags(m.From, args))
+
+	case "tag_synonym":
+		reply = bot_data.Text(b.Tag_Synonym(m.From, args))
+
+	case "webhooks":
+		reply = bot_data.Text(b.Webhooks(m.From))
+
+	case "webhook_add":
+		reply = bot_data.Text(b.Webhook_Add(m.From, m.Chat, args))
+
+	case "webhook_remove":
+		reply = bot_data.Text(b.Webhook_Remove(m.From, args[0]))
+
+	case "audit":
+		reply = bot_data.Text(b.Audit(m.From, args))
+
+	case "recount":
+		reply = bot_data.Text(b.Recount(m.From))
+	}
+	return reply
 }
 
-func checkArguments(args []string, count int) error {
-	if len(args) < count {
-		return errors.New("Введены неправильные аргументы. Посмотрите help")
+// sendUnavailable сообщает пользователю, что база данных недоступна
+func sendUnavailable(b *bot_data.Bot, chatID int64, u *tgbotapi.User) {
+	if err := b.SendReply(chatID, bot_data.Text(b.UnavailableText(u))); err != nil {
+		log.Printf("ошибка отправки сообщения о недоступности: %v", err)
 	}
-	return nil
+}
+
+// sendBanned сообщает пользователю, что он заблокирован
+func sendBanned(b *bot_data.Bot, chatID int64, u *tgbotapi.User) {
+	if err := b.SendReply(chatID, bot_data.Text(b.T(u.ID, "banned"))); err != nil {
+		log.Printf("ошибка отправки сообщения о блокировке: %v", err)
+	}
+}
+
+// requireDB отвечает 503, пока база данных недоступна
+func requireDB(b *bot_data.Bot, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !b.Available() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(database.HealthInterval.Seconds())+1))
+			http.Error(w, "service temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // startTaskBot запускает сервер и слушает вебхуки Telegram
@@ -68,17 +200,23 @@ func startTaskBot(ctx context.Context) error {
 			return
 		}
 
-		if update.Message == nil {
-			return
-		}
-
-		var msg tgbotapi.MessageConfig
-
-		cmd, err := ParseMessageCommand(update.Message.Command(), " ")
-		if err != nil {
-			msg = tgbotapi.NewMessage(update.Message.Chat.ID, "Неверный формат ID")
-			_, err = b.API.Send(msg)
-			if err != nil {
+		if update.CallbackQuery != nil {
+			if _, err := b.API.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "")); err != nil {
+				log.Printf("ошибка ответа на callback: %v", err)
+			}
+			if update.CallbackQuery.Message == nil {
+				return
+			}
+			if !b.Available() {
+				sendUnavailable(&b, update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.From)
+				return
+			}
+			if b.IsBanned(update.CallbackQuery.From.ID) {
+				sendBanned(&b, update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.From)
+				return
+			}
+			reply := b.HandleCallback(update.CallbackQuery)
+			if err := b.SendReply(update.CallbackQuery.Message.Chat.ID, reply); err != nil {
 				if err = json.NewEncoder(w).Encode(err); err != nil {
 					return
 				}
@@ -86,67 +224,34 @@ func startTaskBot(ctx context.Context) error {
 			return
 		}
 
-		log.Printf("start task bot")
-		switch cmd[0] {
-		case "help":
-			log.Printf("print help")
-			msg = tgbotapi.NewMessage(update.Message.Chat.ID, b.Help())
-			msg.ReplyMarkup = helperKeyboard
-
-		case "start":
-			msg = tgbotapi.NewMessage(update.Message.Chat.ID, b.Start(update.Message.From))
-
-		case "ask":
-			msg = tgbotapi.NewMessage(update.Message.Chat.ID, b.Ask(update.Message.From, update.Message.CommandArguments()))
-
-		case "answer":
-			args, _ := ParseMessageCommand(update.Message.CommandArguments(), "~")
-			if checkArguments(args, 1) == nil {
-				msg = tgbotapi.NewMessage(update.Message.Chat.ID, b.Answer(update.Message.From, args))
-			} else {
-				msg = tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при передаче аргументов")
-			}
-
-		case "questions":
-			args, _ := ParseMessageCommand(update.Message.CommandArguments(), " ")
-			if checkArguments(args, 1) == nil {
-				msg = tgbotapi.NewMessage(update.Message.Chat.ID, b.Questions(update.Message.From, args[0]))
-			} else {
-				msg = tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при передаче аргументов")
-			}
-
-		case "my_questions":
-			msg = tgbotapi.NewMessage(update.Message.Chat.ID, b.My_Questions(update.Message.From))
-
-		case "like_question":
-			args, _ := ParseMessageCommand(update.Message.CommandArguments(), " ")
-			if checkArguments(args, 1) == nil {
-				msg = tgbotapi.NewMessage(update.Message.Chat.ID, b.Like_Question(update.Message.From, args[0]))
-			} else {
-				msg = tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при передаче аргументов")
-			}
-
-		case "like_answer":
-			args, _ := ParseMessageCommand(update.Message.CommandArguments(), " ")
-			if checkArguments(args, 1) == nil {
-				msg = tgbotapi.NewMessage(update.Message.Chat.ID, b.Like_Answer(update.Message.From, args[0]))
-			} else {
-				msg = tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при передаче аргументов")
-			}
-
-		case "get_answers":
-			args, _ := ParseMessageCommand(update.Message.CommandArguments(), " ")
-			if checkArguments(args, 1) == nil {
-				msg = tgbotapi.NewMessage(update.Message.Chat.ID, b.Get_Answers(update.Message.From, args[0]))
-			} else {
-				msg = tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка при передаче аргументов")
-			}
-
-		default:
-			msg = tgbotapi.NewMessage(update.Message.Chat.ID, "я не знаю такой команды :(")
+		if update.Message == nil {
+			return
 		}
 
-		_, err = b.API.Send(msg)
+		m := update.Message
+		bot_data.CaptionAsText(m)
+		// в группах отвечаем только на команды этому боту
+		if bot_data.IsGroup(m.Chat) && !b.AddressedToMe(m) {
+			return
+		}
+		if !b.Available() {
+			sendUnavailable(&b, m.Chat.ID, m.From)
+			return
+		}
+		if b.IsBanned(m.From.ID) {
+			sendBanned(&b, m.Chat.ID, m.From)
+			return
+		}
+		b.EnterChat(m)
+		reply := handleCommand(&b, m)
+
+		chatID := b.ReplyChat(m)
+		err = b.SendReply(chatID, reply)
+		if err != nil && chatID != m.Chat.ID {
+			// пользователь ещё не писал боту в личные сообщения
+			log.Printf("ошибка отправки в личные сообщения: %v", err)
+			err = b.SendReply(m.Chat.ID, bot_data.Text(b.T(m.From.ID, "private_unavailable")))
+		}
 		if err != nil {
 			if err = json.NewEncoder(w).Encode(err); err != nil {
 				return
@@ -154,6 +259,29 @@ func startTaskBot(ctx context.Context) error {
 		}
 	})
 
+	// REST API для внутренних инструментов
+	http.Handle(api.Prefix, requireDB(&b, api.NewHandler(&b)))
+	// Веб-интерфейс для чтения вопросов
+	http.Handle(web.Prefix, requireDB(&b, web.NewHandler(&b)))
+	// Atom-ленты по тегам, вопросам без ответов и ответам на вопрос
+	http.Handle(feeds.Prefix, requireDB(&b, feeds.NewHandler(&b)))
+	// Проверка состояния для балансировщика и мониторинга
+	http.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if !b.Available() {
+			http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	// Проверка базы данных и выход из режима ограниченной работы
+	go b.MonitorDB(ctx, *database.HealthInterval)
+
+	// Рассылка дайджестов по расписанию
+	go b.RunDigests(ctx, *bot_data.DigestInterval)
+	// Доставка уведомлений и вебхуков из outbox
+	go b.RunOutbox(ctx, *bot_data.OutboxInterval)
+
 	// Создаем http.Server
 	srv := &http.Server{Addr: Port}
 
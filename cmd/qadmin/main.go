@@ -0,0 +1,271 @@
+// qadmin - утилита администратора: работает с той же базой и тем же кодом
+// хранилища, что и бот, и записывает действия в журнал аудита.
+package main
+
+import (
+	"QADots/bot_data"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var Actor = flag.Int64("actor", 0, "telegram user id recorded in the audit log as the operator")
+
+const usage = `Использование: qadmin [флаги] <команда> [аргументы]
+
+Команды:
+  users [-banned] [-limit N] [-page N]  список пользователей
+  ban <user_id>                         заблокировать пользователя
+  unban <user_id>                       разблокировать пользователя
+  status <user_id> <status_id>          сменить статус пользователя
+  delete <question_id>                  удалить вопрос
+  restore <question_id>                 восстановить удалённый вопрос
+  merge <from> <to>                     объединить тег from с тегом to
+  recount                               пересчитать счётчики лайков и ответов
+  stats                                 сводка по базе
+  import [-source S] [-community N] <вопросы> [<ответы>...]
+                                        перенести вопросы и ответы из файлов CSV или JSON
+                                        со столбцами выгрузки бота
+  import -se [-source S] [-community N] <каталог>
+                                        перенести выгрузку Stack Exchange (Posts.xml, Tags.xml)
+  backup create <файл>                  сохранить резервную копию базы
+  backup restore <файл>                 восстановить резервную копию в пустую базу
+
+Флаги:
+`
+
+func main() {
+	// qadmin запускают из cmd/qadmin, и ждать базу, как бот, не нужно
+	flag.Set("db.config", "../../configs/db_config.json")
+	flag.Set("db.connect_attempts", "1")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var b bot_data.Bot
+	if err := b.InitStore(); err != nil {
+		fail(err)
+	}
+	if !b.Available() {
+		fail(fmt.Errorf("база данных недоступна"))
+	}
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "users":
+		listUsers(&b, args)
+	case "ban", "unban":
+		userID := intArg(args, 0, "user_id")
+		check(b.SetBanned(*Actor, userID, cmd == "ban"))
+		fmt.Printf("Пользователь %d %s\n", userID, map[string]string{"ban": "заблокирован", "unban": "разблокирован"}[cmd])
+		printCacheDelay()
+	case "status":
+		userID, statusID := intArg(args, 0, "user_id"), intArg(args, 1, "status_id")
+		check(b.SetUserStatus(*Actor, userID, int(statusID)))
+		fmt.Printf("Статус пользователя %d: %d\n", userID, statusID)
+		printCacheDelay()
+	case "delete", "restore":
+		questionID := intArg(args, 0, "question_id")
+		check(b.SetQuestionDeleted(*Actor, questionID, cmd == "delete"))
+		fmt.Printf("Вопрос %d %s\n", questionID, map[string]string{"delete": "удалён", "restore": "восстановлен"}[cmd])
+	case "merge":
+		if len(args) != 2 {
+			fail(fmt.Errorf("нужны два тега: merge <from> <to>"))
+		}
+		from, to, err := b.MergeTags(*Actor, args[0], args[1])
+		check(err)
+		fmt.Printf("Тег %s объединён с тегом %s\n", from, to)
+	case "recount":
+		questions, answers, err := b.RecountCounters()
+		check(err)
+		fmt.Printf("Исправлено вопросов: %d, ответов: %d\n", questions, answers)
+	case "stats":
+		printStats(&b)
+	case "import":
+		importData(&b, args)
+	case "backup":
+		if len(args) != 2 {
+			fail(fmt.Errorf("нужны действие и файл: backup create|restore <файл>"))
+		}
+		switch args[0] {
+		case "create":
+			backup(&b, args[1])
+		case "restore":
+			restore(&b, args[1])
+		default:
+			fail(fmt.Errorf("неизвестное действие %s: backup create|restore <файл>", args[0]))
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func listUsers(b *bot_data.Bot, args []string) {
+	fs := flag.NewFlagSet("users", flag.ExitOnError)
+	banned := fs.Bool("banned", false, "only banned users")
+	limit := fs.Int("limit", 50, "users per page")
+	page := fs.Int("page", 1, "page number")
+	fs.Parse(args)
+	if *limit < 1 || *page < 1 {
+		fail(fmt.Errorf("limit и page должны быть положительными"))
+	}
+
+	users, total, err := b.ListUsers(bot_data.UserFilter{Banned: *banned, Limit: *limit, Offset: (*page - 1) * *limit})
+	check(err)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tSTATUS\tREGISTERED\tBANNED\tQUESTIONS\tANSWERS")
+	for _, u := range users {
+		bannedAt := "-"
+		if u.BannedAt != nil {
+			bannedAt = u.BannedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d %s\t%s\t%s\t%d\t%d\n", u.ID, u.Username, u.StatusID, u.Status,
+			u.RegisteredAt.Local().Format(time.DateTime), bannedAt, u.Questions, u.Answers)
+	}
+	w.Flush()
+	fmt.Printf("Показано %d из %d\n", len(users), total)
+}
+
+func printStats(b *bot_data.Bot) {
+	s, err := b.Stats()
+	check(err)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Пользователи\t%d\n", s.Users)
+	fmt.Fprintf(w, "  заблокированы\t%d\n", s.BannedUsers)
+	fmt.Fprintf(w, "Вопросы\t%d\n", s.Questions)
+	fmt.Fprintf(w, "  закрыты\t%d\n", s.ClosedQuestions)
+	fmt.Fprintf(w, "  удалены\t%d\n", s.DeletedQuestions)
+	fmt.Fprintf(w, "Ответы\t%d\n", s.Answers)
+	fmt.Fprintf(w, "Лайки вопросов\t%d\n", s.QuestionLikes)
+	fmt.Fprintf(w, "Лайки ответов\t%d\n", s.AnswerLikes)
+	fmt.Fprintf(w, "Теги\t%d\n", s.Tags)
+	fmt.Fprintf(w, "Сообщества\t%d\n", s.Communities)
+	fmt.Fprintf(w, "Неотправленные уведомления\t%d\n", s.OutboxPending)
+	w.Flush()
+}
+
+func importData(b *bot_data.Bot, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	se := fs.Bool("se", false, "import a Stack Exchange dump directory")
+	source := fs.String("source", "", "source name remembered for re-runs, defaults to the file or directory name")
+	community := fs.Int64("community", 0, "community to import questions into, 0 for the public space")
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) == 0 || *se && len(args) != 1 {
+		fail(fmt.Errorf("не указаны файлы для импорта"))
+	}
+	if *source == "" {
+		*source = filepath.Base(args[0])
+		if !*se {
+			*source = strings.TrimSuffix(*source, filepath.Ext(*source))
+		}
+	}
+
+	var data bot_data.ImportData
+	if *se {
+		var err error
+		data, err = bot_data.ReadStackExchange(args[0])
+		check(err)
+	} else {
+		questions, err := bot_data.ReadTableFile(args[0])
+		check(err)
+		var answers []bot_data.Table
+		for _, path := range args[1:] {
+			t, err := bot_data.ReadTableFile(path)
+			check(err)
+			answers = append(answers, t)
+		}
+		data, err = bot_data.ImportTables(questions, answers)
+		check(err)
+	}
+
+	r, err := b.Import(*Actor, *source, *community, data)
+	check(err)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Источник\t%s\n", *source)
+	fmt.Fprintf(w, "Новые пользователи\t%d\n", r.UsersCreated)
+	fmt.Fprintf(w, "Новые теги\t%d\n", r.TagsCreated)
+	fmt.Fprintf(w, "Вопросы\tдобавлено %d, обновлено %d\n", r.QuestionsCreated, r.QuestionsUpdated)
+	fmt.Fprintf(w, "Ответы\tдобавлено %d, обновлено %d\n", r.AnswersCreated, r.AnswersUpdated)
+	fmt.Fprintf(w, "Пропущено\t%d\n", r.Skipped)
+	w.Flush()
+}
+
+func backup(b *bot_data.Bot, path string) {
+	f, err := os.Create(path)
+	check(err)
+	m, err := b.Backup(*Actor, f)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		// недописанная копия хуже, чем никакой
+		f.Close()
+		os.Remove(path)
+		fail(err)
+	}
+	printManifest(m)
+}
+
+func restore(b *bot_data.Bot, path string) {
+	f, err := os.Open(path)
+	check(err)
+	defer f.Close()
+	info, err := f.Stat()
+	check(err)
+	m, err := b.Restore(*Actor, f, info.Size())
+	check(err)
+	printManifest(m)
+}
+
+func printManifest(m bot_data.BackupManifest) {
+	fmt.Printf("Копия от %s, схема версии %d, %s\n", m.CreatedAt.Local().Format(time.DateTime), m.SchemaVersion, m.Driver)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, t := range m.Tables {
+		fmt.Fprintf(w, "%s\t%d\n", t.Name, t.Rows)
+	}
+	fmt.Fprintf(w, "Всего записей\t%d\n", m.Rows())
+	w.Flush()
+}
+
+// printCacheDelay напоминает, что запущенный бот кэширует блокировки и ответы
+// и увидит изменение, сделанное qadmin, только когда истечёт срок кэша.
+func printCacheDelay() {
+	fmt.Printf("Запущенный бот применит изменение в течение %v (флаг -cache.ttl бота)\n", *bot_data.CacheTTL)
+}
+
+// intArg разбирает числовой аргумент команды с номером i.
+func intArg(args []string, i int, name string) int64 {
+	if len(args) <= i {
+		fail(fmt.Errorf("не указан %s", name))
+	}
+	v, err := strconv.ParseInt(args[i], 10, 64)
+	if err != nil {
+		fail(fmt.Errorf("%s должен быть числом: %s", name, args[i]))
+	}
+	return v
+}
+
+func check(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "qadmin:", err)
+	os.Exit(1)
+}
@@ -1,17 +1,31 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"sync/atomic"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
+// Драйверы хранилища
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 type DBConfig struct {
 	Database struct {
+		// Driver - postgres (по умолчанию) или sqlite
+		Driver string `json:"driver"`
+		// Path - файл базы SQLite
+		Path     string `json:"path"`
 		User     string `json:"user"`
 		Password string `json:"password"`
 		Dbname   string `json:"dbname"`
@@ -37,31 +51,145 @@ func loadConfig(configPath string) (*DBConfig, error) {
 	return &config, nil
 }
 
+var (
+	ConfigPath      = flag.String("db.config", "../configs/db_config.json", "path to the database config file")
+	MaxOpenConns    = flag.Int("db.max_open_conns", 20, "maximum open connections to the database, 0 means unlimited")
+	MaxIdleConns    = flag.Int("db.max_idle_conns", 5, "maximum idle connections kept in the pool")
+	ConnMaxLifetime = flag.Duration("db.conn_max_lifetime", 30*time.Minute, "maximum time a connection may be reused, 0 means no limit")
+	ConnectAttempts = flag.Int("db.connect_attempts", 5, "connection attempts at startup before the bot starts in degraded mode")
+	ConnectBackoff  = flag.Duration("db.connect_backoff", time.Second, "delay before the second connection attempt, doubled after each failure")
+	HealthInterval  = flag.Duration("db.health_interval", 5*time.Second, "how often to check the database connection")
+)
+
+// pingTimeout - сколько ждать ответа базы при проверке соединения
+const pingTimeout = 5 * time.Second
+
 type DB struct {
 	Db *sql.DB
+	// Driver - драйвер хранилища, от него зависят миграции
+	Driver string
+
+	// available - база отвечает и миграции применены
+	available atomic.Bool
+	migrated  atomic.Bool
 }
 
+// InitDB открывает пул соединений и ждёт базу, повторяя попытки с растущей задержкой.
+// Если база так и не ответила, бот запускается в режиме ограниченной работы,
+// а Monitor подключит его к базе, когда она станет доступна.
 func InitDB() *DB {
-	var dtbase DB
-	var err error
-	config, err := loadConfig("../configs/db_config.json")
+	config, err := loadConfig(*ConfigPath)
 	if err != nil {
 		log.Fatalf("Config was not load: %v", err)
 	}
 
-	dsl := fmt.Sprintf("user=%s password=%s dbname=%s sslmode=%s port=%s",
-		config.Database.User, config.Database.Password, config.Database.Dbname, config.Database.Sslmode, config.Database.Port)
-	fmt.Printf(dsl)
-	dtbase.Db, err = sql.Open("postgres", dsl)
+	var source string
+	switch config.Database.Driver {
+	case "", DriverPostgres:
+		config.Database.Driver = DriverPostgres
+		source = fmt.Sprintf("user=%s password=%s dbname=%s sslmode=%s port=%s",
+			config.Database.User, config.Database.Password, config.Database.Dbname, config.Database.Sslmode, config.Database.Port)
+		// пароль из строки подключения в лог не попадает
+		log.Printf("Подключение к Postgres: база %s, порт %s", config.Database.Dbname, config.Database.Port)
+	case DriverSQLite:
+		source = config.Database.Path
+	}
+	dtbase, err := Open(config.Database.Driver, source)
 	if err != nil {
 		log.Fatal("Ошибка подключения к базе данных: ", err)
 	}
 
-	err = dtbase.Db.Ping()
+	delay := *ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		err = dtbase.Check()
+		if err == nil {
+			break
+		}
+		log.Printf("База данных недоступна, попытка %d из %d: %v", attempt, *ConnectAttempts, err)
+		if attempt >= *ConnectAttempts {
+			log.Printf("Запуск без базы данных, бот будет отвечать, что сервис недоступен")
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	return dtbase
+}
+
+// Open открывает пул соединений драйвера driver, не дожидаясь базы. source - строка
+// подключения Postgres или путь к файлу SQLite.
+func Open(driver, source string) (*DB, error) {
+	dtbase := &DB{Driver: driver}
+	var err error
+	switch driver {
+	case DriverPostgres:
+		dtbase.Db, err = sql.Open("postgres", source)
+	case DriverSQLite:
+		dtbase.Db, err = openSQLite(source)
+	default:
+		err = fmt.Errorf("неизвестный драйвер %q", driver)
+	}
 	if err != nil {
-		log.Fatal("Ошибка при проверке подключения к базе данных: ", err)
+		return nil, err
 	}
+	dtbase.Db.SetMaxOpenConns(*MaxOpenConns)
+	dtbase.Db.SetMaxIdleConns(*MaxIdleConns)
+	dtbase.Db.SetConnMaxLifetime(*ConnMaxLifetime)
+	return dtbase, nil
+}
+
+// Available сообщает, что база отвечает и с ней можно работать.
+func (d *DB) Available() bool {
+	return d.available.Load()
+}
+
+// Check проверяет соединение и применяет миграции, если это ещё не сделано.
+func (d *DB) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	if err := d.Db.PingContext(ctx); err != nil {
+		d.setAvailable(false)
+		return err
+	}
+	if !d.migrated.Load() {
+		if err := d.Migrate(); err != nil {
+			d.setAvailable(false)
+			return fmt.Errorf("ошибка при миграции базы данных: %v", err)
+		}
+		d.migrated.Store(true)
+	}
+	d.setAvailable(true)
+	return nil
+}
 
-	fmt.Println("Подключение к базе данных установлено успешно!")
-	return &dtbase
+func (d *DB) setAvailable(v bool) {
+	if d.available.Swap(v) == v {
+		return
+	}
+	if v {
+		fmt.Println("Подключение к базе данных установлено успешно!")
+	} else {
+		log.Printf("Соединение с базой данных потеряно")
+	}
+}
+
+// Monitor периодически проверяет соединение с базой, пока не отменён ctx.
+// Пул сам переподключается к базе, когда она возвращается, а Monitor
+// снимает режим ограниченной работы.
+func (d *DB) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := d.Check(); err != nil {
+			log.Printf("Проверка базы данных: %v", err)
+		}
+	}
 }
@@ -0,0 +1,549 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// migrations создают таблицы, которые нужны боту поверх основной схемы.
+// Каждая инструкция должна быть идемпотентной: они выполняются при каждом запуске.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS public.tagsubscriptions (
+		user_id BIGINT NOT NULL REFERENCES public.users(user_id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES public.tags(tag_id) ON DELETE CASCADE,
+		PRIMARY KEY (user_id, tag_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS public.digestsettings (
+		user_id BIGINT PRIMARY KEY REFERENCES public.users(user_id) ON DELETE CASCADE,
+		frequency TEXT NOT NULL DEFAULT 'off',
+		last_sent_at TIMESTAMPTZ
+	);`,
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm;`,
+	`CREATE INDEX IF NOT EXISTS questions_text_trgm_idx
+		ON public.questions USING gin (question_text gin_trgm_ops);`,
+	`CREATE TABLE IF NOT EXISTS public.tagsynonyms (
+		alias TEXT PRIMARY KEY,
+		tag_id INTEGER NOT NULL REFERENCES public.tags(tag_id) ON DELETE CASCADE
+	);`,
+	`ALTER TABLE public.tags ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE IF NOT EXISTS public.usersettings (
+		user_id BIGINT PRIMARY KEY REFERENCES public.users(user_id) ON DELETE CASCADE,
+		locale TEXT NOT NULL DEFAULT 'ru',
+		timezone TEXT NOT NULL DEFAULT 'Europe/Moscow',
+		export_attachments BOOLEAN NOT NULL DEFAULT true,
+		export_format TEXT NOT NULL DEFAULT 'csv',
+		notify_answers BOOLEAN NOT NULL DEFAULT true,
+		notify_likes BOOLEAN NOT NULL DEFAULT false
+	);`,
+	`CREATE TABLE IF NOT EXISTS public.attachments (
+		attachment_id SERIAL PRIMARY KEY,
+		question_id INTEGER REFERENCES public.questions(question_id) ON DELETE CASCADE,
+		answer_id INTEGER REFERENCES public.answers(answer_id) ON DELETE CASCADE,
+		kind TEXT NOT NULL,
+		file_id TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		CHECK ((question_id IS NULL) <> (answer_id IS NULL))
+	);`,
+	`CREATE INDEX IF NOT EXISTS attachments_question_idx ON public.attachments (question_id);`,
+	`CREATE INDEX IF NOT EXISTS attachments_answer_idx ON public.attachments (answer_id);`,
+	`CREATE TABLE IF NOT EXISTS public.chatsettings (
+		chat_id BIGINT PRIMARY KEY,
+		reply_mode TEXT NOT NULL DEFAULT 'group'
+	);`,
+	`CREATE TABLE IF NOT EXISTS public.communities (
+		community_id SERIAL PRIMARY KEY,
+		name TEXT NOT NULL,
+		chat_id BIGINT UNIQUE,
+		invite_code TEXT NOT NULL UNIQUE,
+		created_by BIGINT REFERENCES public.users(user_id) ON DELETE SET NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`,
+	`CREATE TABLE IF NOT EXISTS public.communitymembers (
+		community_id INTEGER NOT NULL REFERENCES public.communities(community_id) ON DELETE CASCADE,
+		user_id BIGINT NOT NULL REFERENCES public.users(user_id) ON DELETE CASCADE,
+		joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (community_id, user_id)
+	);`,
+	`ALTER TABLE public.questions ADD COLUMN IF NOT EXISTS community_id INTEGER
+		REFERENCES public.communities(community_id) ON DELETE CASCADE;`,
+	`CREATE INDEX IF NOT EXISTS questions_community_idx ON public.questions (community_id);`,
+	`ALTER TABLE public.usersettings ADD COLUMN IF NOT EXISTS community_id INTEGER
+		REFERENCES public.communities(community_id) ON DELETE SET NULL;`,
+	`CREATE TABLE IF NOT EXISTS public.webhooks (
+		webhook_id SERIAL PRIMARY KEY,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT[] NOT NULL DEFAULT '{}',
+		active BOOLEAN NOT NULL DEFAULT true,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`,
+	`CREATE TABLE IF NOT EXISTS public.webhookdeliveries (
+		delivery_id BIGSERIAL PRIMARY KEY,
+		webhook_id INTEGER NOT NULL REFERENCES public.webhooks(webhook_id) ON DELETE CASCADE,
+		event TEXT NOT NULL,
+		payload JSONB,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		status_code INTEGER,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		delivered_at TIMESTAMPTZ
+	);`,
+	`CREATE INDEX IF NOT EXISTS webhookdeliveries_webhook_idx ON public.webhookdeliveries (webhook_id, created_at);`,
+	`CREATE TABLE IF NOT EXISTS public.outbox (
+		outbox_id BIGSERIAL PRIMARY KEY,
+		kind TEXT NOT NULL,
+		dedup_key TEXT NOT NULL UNIQUE,
+		payload JSONB NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		sent_at TIMESTAMPTZ
+	);`,
+	`CREATE INDEX IF NOT EXISTS outbox_pending_idx ON public.outbox (next_attempt_at) WHERE sent_at IS NULL;`,
+	`ALTER TABLE public.webhookdeliveries ADD COLUMN IF NOT EXISTS outbox_id BIGINT;`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS webhookdeliveries_outbox_idx ON public.webhookdeliveries (outbox_id);`,
+	`CREATE TABLE IF NOT EXISTS public.audit_log (
+		audit_id BIGSERIAL PRIMARY KEY,
+		actor_id BIGINT NOT NULL,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL DEFAULT '',
+		target_id TEXT NOT NULL DEFAULT '',
+		before JSONB,
+		after JSONB,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`,
+	`CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON public.audit_log (actor_id, created_at);`,
+	`CREATE INDEX IF NOT EXISTS audit_log_target_idx ON public.audit_log (target_type, target_id);`,
+	// журнал только дополняется: изменить или удалить запись нельзя
+	`CREATE OR REPLACE FUNCTION public.audit_log_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql;`,
+	`DROP TRIGGER IF EXISTS audit_log_append_only ON public.audit_log;`,
+	`CREATE TRIGGER audit_log_append_only
+		BEFORE UPDATE OR DELETE OR TRUNCATE ON public.audit_log
+		FOR EACH STATEMENT EXECUTE FUNCTION public.audit_log_append_only();`,
+	// счётчики лайков и ответов: при первом добавлении колонок они заполняются
+	// по существующим данным, дальше их поддерживают триггеры
+	`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_schema = 'public' AND table_name = 'questions' AND column_name = 'like_count') THEN
+			ALTER TABLE public.questions
+				ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0,
+				ADD COLUMN answer_count INTEGER NOT NULL DEFAULT 0;
+			UPDATE public.questions q SET
+				like_count = (SELECT COUNT(*) FROM public.questionlikes ql WHERE ql.question_id = q.question_id),
+				answer_count = (SELECT COUNT(*) FROM public.answers a WHERE a.question_id = q.question_id);
+		END IF;
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_schema = 'public' AND table_name = 'answers' AND column_name = 'like_count') THEN
+			ALTER TABLE public.answers ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+			UPDATE public.answers a SET
+				like_count = (SELECT COUNT(*) FROM public.answerlikes al WHERE al.answer_id = a.answer_id);
+		END IF;
+	END
+	$$;`,
+	// score - рейтинг вопроса: лайк даёт одно очко, ответ - два
+	`ALTER TABLE public.questions ADD COLUMN IF NOT EXISTS score INTEGER
+		GENERATED ALWAYS AS (like_count + 2 * answer_count) STORED;`,
+	`CREATE OR REPLACE FUNCTION public.questionlikes_count() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'INSERT' THEN
+			UPDATE public.questions SET like_count = like_count + 1 WHERE question_id = NEW.question_id;
+		ELSE
+			UPDATE public.questions SET like_count = like_count - 1 WHERE question_id = OLD.question_id;
+		END IF;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;`,
+	`DROP TRIGGER IF EXISTS questionlikes_count ON public.questionlikes;`,
+	`CREATE TRIGGER questionlikes_count
+		AFTER INSERT OR DELETE ON public.questionlikes
+		FOR EACH ROW EXECUTE FUNCTION public.questionlikes_count();`,
+	`CREATE OR REPLACE FUNCTION public.answerlikes_count() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'INSERT' THEN
+			UPDATE public.answers SET like_count = like_count + 1 WHERE answer_id = NEW.answer_id;
+		ELSE
+			UPDATE public.answers SET like_count = like_count - 1 WHERE answer_id = OLD.answer_id;
+		END IF;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;`,
+	`DROP TRIGGER IF EXISTS answerlikes_count ON public.answerlikes;`,
+	`CREATE TRIGGER answerlikes_count
+		AFTER INSERT OR DELETE ON public.answerlikes
+		FOR EACH ROW EXECUTE FUNCTION public.answerlikes_count();`,
+	`CREATE OR REPLACE FUNCTION public.answers_count() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'INSERT' THEN
+			UPDATE public.questions SET answer_count = answer_count + 1 WHERE question_id = NEW.question_id;
+		ELSE
+			UPDATE public.questions SET answer_count = answer_count - 1 WHERE question_id = OLD.question_id;
+		END IF;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;`,
+	`DROP TRIGGER IF EXISTS answers_count ON public.answers;`,
+	`CREATE TRIGGER answers_count
+		AFTER INSERT OR DELETE ON public.answers
+		FOR EACH ROW EXECUTE FUNCTION public.answers_count();`,
+	`CREATE INDEX IF NOT EXISTS questions_like_count_idx ON public.questions (like_count DESC, question_id DESC);`,
+	`CREATE INDEX IF NOT EXISTS questions_score_idx ON public.questions (score DESC, question_id DESC);`,
+	`CREATE INDEX IF NOT EXISTS questions_user_idx ON public.questions (user_id, created_at);`,
+	`CREATE INDEX IF NOT EXISTS questions_unanswered_idx ON public.questions (created_at DESC) WHERE answer_count = 0;`,
+	`CREATE INDEX IF NOT EXISTS answers_question_likes_idx ON public.answers (question_id, like_count DESC);`,
+	// блокировка пользователей и удаление вопросов из qadmin
+	`ALTER TABLE public.users ADD COLUMN IF NOT EXISTS banned_at TIMESTAMPTZ;`,
+	`ALTER TABLE public.questions ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;`,
+	// импорт: соответствие записей источника и записей бота, лайки из источника
+	`CREATE TABLE IF NOT EXISTS public.importmap (
+		source TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		external_id TEXT NOT NULL,
+		local_id BIGINT NOT NULL,
+		PRIMARY KEY (source, kind, external_id)
+	);`,
+	`ALTER TABLE public.questions ADD COLUMN IF NOT EXISTS imported_likes INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE public.answers ADD COLUMN IF NOT EXISTS imported_likes INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE IF NOT EXISTS public.schemaversion (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		version INTEGER NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`,
+	// теги, сохранённые до нормализации: с '#', в разном регистре, пустые и слишком длинные
+	`INSERT INTO public.tags (tag_name, description)
+		SELECT ` + normalizedTag("t.tag_name") + `, MAX(t.description) FROM public.tags t
+		WHERE t.tag_id IN (` + renamedTags + `)
+		GROUP BY ` + normalizedTag("t.tag_name") + `
+		ON CONFLICT (tag_name) DO NOTHING;`,
+	`INSERT INTO public.questiontags (question_id, tag_id)
+		SELECT qt.question_id, n.tag_id FROM public.questiontags qt
+		JOIN public.tags o ON o.tag_id = qt.tag_id
+		JOIN public.tags n ON n.tag_name = ` + normalizedTag("o.tag_name") + `
+		WHERE o.tag_id <> n.tag_id
+		ON CONFLICT DO NOTHING;`,
+	`INSERT INTO public.tagsubscriptions (user_id, tag_id)
+		SELECT ts.user_id, n.tag_id FROM public.tagsubscriptions ts
+		JOIN public.tags o ON o.tag_id = ts.tag_id
+		JOIN public.tags n ON n.tag_name = ` + normalizedTag("o.tag_name") + `
+		WHERE o.tag_id <> n.tag_id
+		ON CONFLICT DO NOTHING;`,
+	`UPDATE public.tagsynonyms SET tag_id = (
+		SELECT n.tag_id FROM public.tags o
+		JOIN public.tags n ON n.tag_name = ` + normalizedTag("o.tag_name") + `
+		WHERE o.tag_id = public.tagsynonyms.tag_id
+	) WHERE tag_id IN (` + renamedTags + `);`,
+	`DELETE FROM public.questiontags WHERE tag_id IN (` + staleTags + `);`,
+	`DELETE FROM public.tagsubscriptions WHERE tag_id IN (` + staleTags + `);`,
+	`DELETE FROM public.tagsynonyms WHERE tag_id IN (` + staleTags + `);`,
+	`DELETE FROM public.tags WHERE tag_id IN (` + staleTags + `);`,
+	// вебхук получает события только своего сообщества, NULL - общего пространства
+	`ALTER TABLE public.webhooks ADD COLUMN IF NOT EXISTS community_id INTEGER
+		REFERENCES public.communities(community_id) ON DELETE CASCADE;`,
+}
+
+// MaxTagLength - максимальная длина тега в символах
+const MaxTagLength = 32
+
+// normalizedTag - выражение SQL, которое приводит тег к виду, как normalizeTag в боте:
+// без пробелов по краям, без ведущих '#', в нижнем регистре. Бот отклоняет теги
+// длиннее MaxTagLength, а сохранённые раньше обрезаются до этой длины.
+func normalizedTag(column string) string {
+	return "lower(substr(ltrim(trim(" + column + "), '#'), 1, " + strconv.Itoa(MaxTagLength) + "))"
+}
+
+// renamedTags - теги, чьё название отличается от непустого канонического. Миграции
+// переносят их вопросы, подписки и синонимы на тег с каноническим названием.
+var renamedTags = "SELECT tag_id FROM public.tags WHERE tag_name <> " + normalizedTag("tag_name") +
+	" AND " + normalizedTag("tag_name") + " <> ''"
+
+// staleTags - переименованные теги и теги, которые после нормализации пусты
+// (например, из двойных пробелов в списке тегов). Миграции удаляют их вместе со
+// связями. После первого запуска таких тегов нет, и эти миграции ничего не делают.
+var staleTags = "SELECT tag_id FROM public.tags WHERE tag_name <> " + normalizedTag("tag_name") +
+	" OR " + normalizedTag("tag_name") + " = ''"
+
+// SchemaVersion - версия схемы бота. Её нужно увеличивать при каждом изменении
+// схемы, добавляя миграции сразу в migrations и sqliteMigrations. Migrate
+// записывает применённую версию в базу, а резервные копии берут её оттуда.
+const SchemaVersion = 54
+
+// Migrate применяет миграции драйвера по порядку.
+func (d *DB) Migrate() error {
+	list := migrations
+	if d.Driver == DriverSQLite {
+		list = sqliteMigrations
+	}
+	for i, m := range list {
+		_, err := d.Db.Exec(m)
+		// в SQLite нет ADD COLUMN IF NOT EXISTS: уже добавленная колонка - не ошибка
+		if err != nil && d.Driver == DriverSQLite && strings.Contains(err.Error(), "duplicate column name") {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка применения миграции %d: %v", i, err)
+		}
+	}
+	// бот старой версии, запущенный на обновлённой базе, не понижает версию
+	query := `
+		INSERT INTO public.schemaversion (id, version, applied_at) VALUES (1, $1, NOW())
+		ON CONFLICT (id) DO UPDATE SET version = EXCLUDED.version, applied_at = EXCLUDED.applied_at
+		WHERE public.schemaversion.version < EXCLUDED.version;
+	`
+	if _, err := d.Db.Exec(query, SchemaVersion); err != nil {
+		return fmt.Errorf("ошибка записи версии схемы: %v", err)
+	}
+	return nil
+}
+
+// sqliteNow - текущее время в UTC в том же текстовом виде, в котором драйвер пишет время
+const sqliteNow = `(strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))`
+
+// sqliteMigrations - та же схема для SQLite, включая основные таблицы, которые
+// в Postgres созданы заранее. База создаётся с нуля, поэтому счётчики не нужно
+// заполнять по существующим данным. Функции CheckUserRegistration и
+// CheckQuestionExistence здесь не нужны: бот проверяет существование запросом EXISTS.
+var sqliteMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS statuses (
+		status_id INTEGER PRIMARY KEY,
+		status_name TEXT NOT NULL
+	);`,
+	`INSERT OR IGNORE INTO statuses (status_id, status_name) VALUES (1, 'user');`,
+	`CREATE TABLE IF NOT EXISTS users (
+		user_id INTEGER PRIMARY KEY,
+		username TEXT NOT NULL DEFAULT '',
+		registration_date TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `,
+		question_count INTEGER NOT NULL DEFAULT 0,
+		answer_count INTEGER NOT NULL DEFAULT 0,
+		status_id INTEGER NOT NULL DEFAULT 1 REFERENCES statuses(status_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS communities (
+		community_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		chat_id INTEGER UNIQUE,
+		invite_code TEXT NOT NULL UNIQUE,
+		created_by INTEGER REFERENCES users(user_id) ON DELETE SET NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `
+	);`,
+	`CREATE TABLE IF NOT EXISTS questions (
+		question_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		question_text TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `,
+		is_closed BOOLEAN NOT NULL DEFAULT false,
+		community_id INTEGER REFERENCES communities(community_id) ON DELETE CASCADE,
+		like_count INTEGER NOT NULL DEFAULT 0,
+		answer_count INTEGER NOT NULL DEFAULT 0,
+		score INTEGER GENERATED ALWAYS AS (like_count + 2 * answer_count) STORED
+	);`,
+	`CREATE TABLE IF NOT EXISTS answers (
+		answer_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		question_id INTEGER NOT NULL REFERENCES questions(question_id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		answer_text TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `,
+		like_count INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE TABLE IF NOT EXISTS tags (
+		tag_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tag_name TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT ''
+	);`,
+	`CREATE TABLE IF NOT EXISTS questiontags (
+		question_id INTEGER NOT NULL REFERENCES questions(question_id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(tag_id) ON DELETE CASCADE,
+		PRIMARY KEY (question_id, tag_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS questionlikes (
+		question_id INTEGER NOT NULL REFERENCES questions(question_id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		PRIMARY KEY (question_id, user_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS answerlikes (
+		answer_id INTEGER NOT NULL REFERENCES answers(answer_id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		PRIMARY KEY (answer_id, user_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS tagsubscriptions (
+		user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		tag_id INTEGER NOT NULL REFERENCES tags(tag_id) ON DELETE CASCADE,
+		PRIMARY KEY (user_id, tag_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS digestsettings (
+		user_id INTEGER PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+		frequency TEXT NOT NULL DEFAULT 'off',
+		last_sent_at TIMESTAMP
+	);`,
+	`CREATE TABLE IF NOT EXISTS tagsynonyms (
+		alias TEXT PRIMARY KEY,
+		tag_id INTEGER NOT NULL REFERENCES tags(tag_id) ON DELETE CASCADE
+	);`,
+	`CREATE TABLE IF NOT EXISTS usersettings (
+		user_id INTEGER PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+		locale TEXT NOT NULL DEFAULT 'ru',
+		timezone TEXT NOT NULL DEFAULT 'Europe/Moscow',
+		export_attachments BOOLEAN NOT NULL DEFAULT true,
+		export_format TEXT NOT NULL DEFAULT 'csv',
+		notify_answers BOOLEAN NOT NULL DEFAULT true,
+		notify_likes BOOLEAN NOT NULL DEFAULT false,
+		community_id INTEGER REFERENCES communities(community_id) ON DELETE SET NULL
+	);`,
+	`CREATE TABLE IF NOT EXISTS attachments (
+		attachment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		question_id INTEGER REFERENCES questions(question_id) ON DELETE CASCADE,
+		answer_id INTEGER REFERENCES answers(answer_id) ON DELETE CASCADE,
+		kind TEXT NOT NULL,
+		file_id TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `,
+		CHECK ((question_id IS NULL) <> (answer_id IS NULL))
+	);`,
+	`CREATE INDEX IF NOT EXISTS attachments_question_idx ON attachments (question_id);`,
+	`CREATE INDEX IF NOT EXISTS attachments_answer_idx ON attachments (answer_id);`,
+	`CREATE TABLE IF NOT EXISTS chatsettings (
+		chat_id INTEGER PRIMARY KEY,
+		reply_mode TEXT NOT NULL DEFAULT 'group'
+	);`,
+	`CREATE TABLE IF NOT EXISTS communitymembers (
+		community_id INTEGER NOT NULL REFERENCES communities(community_id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+		joined_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `,
+		PRIMARY KEY (community_id, user_id)
+	);`,
+	`CREATE INDEX IF NOT EXISTS questions_community_idx ON questions (community_id);`,
+	// events - массив в текстовом формате Postgres, его читает и пишет pq.Array
+	`CREATE TABLE IF NOT EXISTS webhooks (
+		webhook_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '{}',
+		active BOOLEAN NOT NULL DEFAULT true,
+		created_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `
+	);`,
+	`CREATE TABLE IF NOT EXISTS webhookdeliveries (
+		delivery_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL REFERENCES webhooks(webhook_id) ON DELETE CASCADE,
+		event TEXT NOT NULL,
+		payload BLOB,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		status_code INTEGER,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `,
+		delivered_at TIMESTAMP,
+		outbox_id INTEGER
+	);`,
+	`CREATE INDEX IF NOT EXISTS webhookdeliveries_webhook_idx ON webhookdeliveries (webhook_id, created_at);`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS webhookdeliveries_outbox_idx ON webhookdeliveries (outbox_id);`,
+	`CREATE TABLE IF NOT EXISTS outbox (
+		outbox_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		dedup_key TEXT NOT NULL UNIQUE,
+		payload BLOB NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `,
+		created_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `,
+		sent_at TIMESTAMP
+	);`,
+	`CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (next_attempt_at) WHERE sent_at IS NULL;`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor_id INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		target_type TEXT NOT NULL DEFAULT '',
+		target_id TEXT NOT NULL DEFAULT '',
+		before BLOB,
+		after BLOB,
+		created_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `
+	);`,
+	`CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor_id, created_at);`,
+	`CREATE INDEX IF NOT EXISTS audit_log_target_idx ON audit_log (target_type, target_id);`,
+	// журнал только дополняется: изменить или удалить запись нельзя
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit_log is append-only');
+	END;`,
+	// счётчики лайков и ответов поддерживают триггеры
+	`CREATE TRIGGER IF NOT EXISTS questionlikes_count_insert AFTER INSERT ON questionlikes
+	BEGIN
+		UPDATE questions SET like_count = like_count + 1 WHERE question_id = NEW.question_id;
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS questionlikes_count_delete AFTER DELETE ON questionlikes
+	BEGIN
+		UPDATE questions SET like_count = like_count - 1 WHERE question_id = OLD.question_id;
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS answerlikes_count_insert AFTER INSERT ON answerlikes
+	BEGIN
+		UPDATE answers SET like_count = like_count + 1 WHERE answer_id = NEW.answer_id;
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS answerlikes_count_delete AFTER DELETE ON answerlikes
+	BEGIN
+		UPDATE answers SET like_count = like_count - 1 WHERE answer_id = OLD.answer_id;
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS answers_count_insert AFTER INSERT ON answers
+	BEGIN
+		UPDATE questions SET answer_count = answer_count + 1 WHERE question_id = NEW.question_id;
+	END;`,
+	`CREATE TRIGGER IF NOT EXISTS answers_count_delete AFTER DELETE ON answers
+	BEGIN
+		UPDATE questions SET answer_count = answer_count - 1 WHERE question_id = OLD.question_id;
+	END;`,
+	`CREATE INDEX IF NOT EXISTS questions_like_count_idx ON questions (like_count DESC, question_id DESC);`,
+	`CREATE INDEX IF NOT EXISTS questions_score_idx ON questions (score DESC, question_id DESC);`,
+	`CREATE INDEX IF NOT EXISTS questions_user_idx ON questions (user_id, created_at);`,
+	`CREATE INDEX IF NOT EXISTS questions_unanswered_idx ON questions (created_at DESC) WHERE answer_count = 0;`,
+	`CREATE INDEX IF NOT EXISTS answers_question_likes_idx ON answers (question_id, like_count DESC);`,
+	`ALTER TABLE users ADD COLUMN banned_at TIMESTAMP;`,
+	`ALTER TABLE questions ADD COLUMN deleted_at TIMESTAMP;`,
+	`CREATE TABLE IF NOT EXISTS importmap (
+		source TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		external_id TEXT NOT NULL,
+		local_id INTEGER NOT NULL,
+		PRIMARY KEY (source, kind, external_id)
+	);`,
+	`ALTER TABLE questions ADD COLUMN imported_likes INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE answers ADD COLUMN imported_likes INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE IF NOT EXISTS schemaversion (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		version INTEGER NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT ` + sqliteNow + `
+	);`,
+	// теги, сохранённые до нормализации: с '#' и в разном регистре
+	`INSERT INTO tags (tag_name, description)
+		SELECT ` + normalizedTag("t.tag_name") + `, MAX(t.description) FROM tags t
+		WHERE t.tag_id IN (` + renamedTags + `)
+		GROUP BY ` + normalizedTag("t.tag_name") + `
+		ON CONFLICT (tag_name) DO NOTHING;`,
+	`INSERT INTO questiontags (question_id, tag_id)
+		SELECT qt.question_id, n.tag_id FROM questiontags qt
+		JOIN tags o ON o.tag_id = qt.tag_id
+		JOIN tags n ON n.tag_name = ` + normalizedTag("o.tag_name") + `
+		WHERE o.tag_id <> n.tag_id
+		ON CONFLICT DO NOTHING;`,
+	`INSERT INTO tagsubscriptions (user_id, tag_id)
+		SELECT ts.user_id, n.tag_id FROM tagsubscriptions ts
+		JOIN tags o ON o.tag_id = ts.tag_id
+		JOIN tags n ON n.tag_name = ` + normalizedTag("o.tag_name") + `
+		WHERE o.tag_id <> n.tag_id
+		ON CONFLICT DO NOTHING;`,
+	`UPDATE tagsynonyms SET tag_id = (
+		SELECT n.tag_id FROM tags o
+		JOIN tags n ON n.tag_name = ` + normalizedTag("o.tag_name") + `
+		WHERE o.tag_id = tagsynonyms.tag_id
+	) WHERE tag_id IN (` + renamedTags + `);`,
+	`DELETE FROM questiontags WHERE tag_id IN (` + staleTags + `);`,
+	`DELETE FROM tagsubscriptions WHERE tag_id IN (` + staleTags + `);`,
+	`DELETE FROM tagsynonyms WHERE tag_id IN (` + staleTags + `);`,
+	`DELETE FROM tags WHERE tag_id IN (` + staleTags + `);`,
+	`ALTER TABLE webhooks ADD COLUMN community_id INTEGER
+		REFERENCES communities(community_id) ON DELETE CASCADE;`,
+}
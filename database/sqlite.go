@@ -0,0 +1,300 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// SQLite - хранилище для небольших установок, где отдельный Postgres не нужен.
+// Бот пишет запросы на диалекте Postgres, а драйвер sqliteDriverName переводит
+// те конструкции, которые в них встречаются:
+//   - схема public. убирается, приведения типов ::integer и т.п. отбрасываются;
+//   - FOR UPDATE [SKIP LOCKED] не нужен: SQLite выполняет пишущие транзакции по одной;
+//   - ILIKE становится LIKE, а LIKE без учёта регистра и lower() работают и для кириллицы;
+//   - NOW(), similarity() (как в pg_trgm) и array_agg() реализованы на Go,
+//     array_agg возвращает массив в текстовом формате Postgres, который читает pq.Array.
+//
+// Время хранится текстом в UTC, поэтому сравнение строк совпадает со сравнением времени.
+const sqliteDriverName = "qadots-sqlite"
+
+// sqliteBusyTimeout - сколько пишущая транзакция ждёт, пока завершится другая
+const sqliteBusyTimeout = 10 * time.Second
+
+// sqliteTimeFormat - формат, в котором драйвер записывает время (_time_format=sqlite)
+const sqliteTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+var sqliteRewrites = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`\bpublic\.`), ""},
+	{regexp.MustCompile(`::(integer|bigint|text|double precision)\b`), ""},
+	{regexp.MustCompile(`\s+FOR UPDATE(\s+SKIP LOCKED)?`), ""},
+	{regexp.MustCompile(`\bILIKE\b`), "LIKE"},
+}
+
+// sqliteQueries - запросы, уже переведённые на диалект SQLite
+var sqliteQueries sync.Map
+
+func sqliteQuery(query string) string {
+	if q, ok := sqliteQueries.Load(query); ok {
+		return q.(string)
+	}
+	q := query
+	for _, r := range sqliteRewrites {
+		q = r.re.ReplaceAllString(q, r.repl)
+	}
+	sqliteQueries.Store(query, q)
+	return q
+}
+
+// sqliteArgs переводит время в UTC, чтобы все значения времени в базе были в одной зоне.
+func sqliteArgs(args []driver.NamedValue) []driver.NamedValue {
+	for i, a := range args {
+		if t, ok := a.Value.(time.Time); ok {
+			args[i].Value = t.UTC()
+		}
+	}
+	return args
+}
+
+func init() {
+	sqlite.MustRegisterFunction("now", &sqlite.FunctionImpl{
+		NArgs: 0,
+		Scalar: func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			return time.Now().UTC().Format(sqliteTimeFormat), nil
+		},
+	})
+	sqlite.MustRegisterFunction("similarity", &sqlite.FunctionImpl{
+		NArgs:         2,
+		Deterministic: true,
+		Scalar: func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			return similarity(sqliteText(args[0]), sqliteText(args[1])), nil
+		},
+	})
+	// встроенная lower() меняет регистр только латиницы
+	sqlite.MustRegisterFunction("lower", &sqlite.FunctionImpl{
+		NArgs:         1,
+		Deterministic: true,
+		Scalar: func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			return strings.ToLower(sqliteText(args[0])), nil
+		},
+	})
+	// like(pattern, value[, escape]) заменяет встроенный оператор LIKE
+	sqlite.MustRegisterFunction("like", &sqlite.FunctionImpl{
+		NArgs:         -1,
+		Deterministic: true,
+		Scalar: func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			if len(args) < 2 || len(args) > 3 {
+				return nil, fmt.Errorf("wrong number of arguments to function like()")
+			}
+			if args[0] == nil || args[1] == nil {
+				return nil, nil
+			}
+			var escape rune
+			if len(args) == 3 {
+				e := []rune(sqliteText(args[2]))
+				if len(e) != 1 {
+					return nil, fmt.Errorf("ESCAPE expression must be a single character")
+				}
+				escape = e[0]
+			}
+			pattern := []rune(strings.ToLower(sqliteText(args[0])))
+			return likeMatch(pattern, []rune(strings.ToLower(sqliteText(args[1]))), escape), nil
+		},
+	})
+	sqlite.MustRegisterFunction("array_agg", &sqlite.FunctionImpl{
+		NArgs: 1,
+		MakeAggregate: func(ctx sqlite.FunctionContext) (sqlite.AggregateFunction, error) {
+			return &arrayAgg{}, nil
+		},
+	})
+
+	base, err := sql.Open("sqlite", "")
+	if err != nil {
+		panic(err)
+	}
+	sql.Register(sqliteDriverName, sqliteDriver{base.Driver()})
+	base.Close()
+}
+
+// openSQLite открывает файл базы SQLite, создавая его при необходимости.
+func openSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("не указан путь к файлу базы SQLite")
+	}
+	q := url.Values{}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", sqliteBusyTimeout.Milliseconds()))
+	q.Set("_txlock", "immediate")
+	q.Set("_time_format", "sqlite")
+	return sql.Open(sqliteDriverName, "file:"+path+"?"+q.Encode())
+}
+
+type sqliteDriver struct {
+	base driver.Driver
+}
+
+func (d sqliteDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteConn{c.(sqliteBaseConn)}, nil
+}
+
+// sqliteBaseConn - интерфейсы соединения modernc.org/sqlite, которые использует database/sql
+type sqliteBaseConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+// sqliteConn переводит запросы на диалект SQLite перед выполнением.
+type sqliteConn struct {
+	sqliteBaseConn
+}
+
+func (c sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.sqliteBaseConn.Prepare(sqliteQuery(query))
+}
+
+func (c sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.sqliteBaseConn.PrepareContext(ctx, sqliteQuery(query))
+}
+
+func (c sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.sqliteBaseConn.ExecContext(ctx, sqliteQuery(query), sqliteArgs(args))
+}
+
+func (c sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.sqliteBaseConn.QueryContext(ctx, sqliteQuery(query), sqliteArgs(args))
+}
+
+func sqliteText(v driver.Value) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// likeMatch сопоставляет строку с шаблоном LIKE: % - любая последовательность,
+// _ - любой символ, escape (если задан) экранирует следующий символ.
+func likeMatch(pattern, s []rune, escape rune) bool {
+	for len(pattern) > 0 {
+		p := pattern[0]
+		switch {
+		case escape != 0 && p == escape:
+			if len(pattern) < 2 || len(s) == 0 || s[0] != pattern[1] {
+				return false
+			}
+			pattern, s = pattern[2:], s[1:]
+		case p == '%':
+			for len(pattern) > 0 && pattern[0] == '%' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range s {
+				if likeMatch(pattern, s[i:], escape) {
+					return true
+				}
+			}
+			return false
+		case p == '_':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		default:
+			if len(s) == 0 || s[0] != p {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// trigrams возвращает триграммы строки так же, как pg_trgm: слова из букв и цифр
+// в нижнем регистре дополняются двумя пробелами в начале и одним в конце.
+func trigrams(s string) map[string]struct{} {
+	result := make(map[string]struct{})
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			result[string(r[i:i+3])] = struct{}{}
+		}
+	}
+	return result
+}
+
+// similarity - доля общих триграмм двух строк, как similarity() из pg_trgm.
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// arrayAgg собирает значения в массив в текстовом формате Postgres.
+type arrayAgg struct {
+	values pq.StringArray
+}
+
+func (a *arrayAgg) Step(ctx *sqlite.FunctionContext, args []driver.Value) error {
+	a.values = append(a.values, sqliteText(args[0]))
+	return nil
+}
+
+func (a *arrayAgg) WindowInverse(ctx *sqlite.FunctionContext, args []driver.Value) error {
+	a.values = a.values[1:]
+	return nil
+}
+
+func (a *arrayAgg) WindowValue(ctx *sqlite.FunctionContext) (driver.Value, error) {
+	// как и в Postgres, массив из пустой выборки - NULL
+	if len(a.values) == 0 {
+		return nil, nil
+	}
+	return a.values.Value()
+}
+
+func (a *arrayAgg) Final(ctx *sqlite.FunctionContext) {}
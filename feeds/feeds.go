@@ -0,0 +1,248 @@
+package feeds
+
+import (
+	"QADots/bot_data"
+	"QADots/web"
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix - путь, под которым обслуживаются Atom-ленты.
+const Prefix = "/feeds/"
+
+const (
+	feedEntries   = 50
+	titleLength   = 80
+	feedExtension = ".atom"
+)
+
+// Store - источник данных лент. Его реализует bot_data.Bot. Как и веб-интерфейс,
+// ленты показывают только общее пространство.
+type Store interface {
+	ListQuestions(f bot_data.QuestionFilter) ([]bot_data.QuestionSummary, int, error)
+	Question(communityID, questionID int64) (bot_data.QuestionDetail, error)
+}
+
+type feed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Links   []link   `xml:"link"`
+	Entries []entry  `xml:"entry"`
+}
+
+type link struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type entry struct {
+	Title      string     `xml:"title"`
+	ID         string     `xml:"id"`
+	Published  string     `xml:"published"`
+	Updated    string     `xml:"updated"`
+	Author     author     `xml:"author"`
+	Link       link       `xml:"link"`
+	Categories []category `xml:"category"`
+	Content    content    `xml:"content"`
+}
+
+type author struct {
+	Name string `xml:"name"`
+}
+
+type category struct {
+	Term string `xml:"term,attr"`
+}
+
+type content struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type handler struct {
+	store Store
+}
+
+// NewHandler возвращает обработчик всех путей /feeds.
+func NewHandler(s Store) http.Handler {
+	h := &handler{store: s}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+Prefix+"tag/{file}", h.tag)
+	mux.HandleFunc("GET "+Prefix+"unanswered.atom", h.unanswered)
+	mux.HandleFunc("GET "+Prefix+"question/{file}", h.question)
+	mux.HandleFunc(Prefix, http.NotFound)
+	return mux
+}
+
+// baseURL - адрес сервера для абсолютных ссылок в ленте.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// feedName отрезает .atom от последнего сегмента пути.
+func feedName(r *http.Request) (string, bool) {
+	return strings.CutSuffix(r.PathValue("file"), feedExtension)
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func title(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > titleLength {
+		return string(r[:titleLength-1]) + "…"
+	}
+	return text
+}
+
+// authorName - в Atom имя автора обязательно, а username в Telegram может быть пустым.
+func authorName(username string, userID int64) author {
+	if username == "" {
+		username = "id" + strconv.FormatInt(userID, 10)
+	}
+	return author{Name: username}
+}
+
+func questionURL(base string, id int64) string {
+	return base + web.Prefix + "questions/" + strconv.FormatInt(id, 10)
+}
+
+func questionEntries(base string, questions []bot_data.QuestionSummary) []entry {
+	entries := make([]entry, 0, len(questions))
+	for _, q := range questions {
+		e := entry{
+			Title:     title(q.Text),
+			ID:        questionURL(base, q.ID),
+			Published: atomTime(q.CreatedAt),
+			Updated:   atomTime(q.CreatedAt),
+			Author:    authorName(q.Username, q.UserID),
+			Link:      link{Href: questionURL(base, q.ID)},
+			Content:   content{Type: "html", Body: bot_data.RenderHTML(q.Text)},
+		}
+		for _, t := range q.Tags {
+			e.Categories = append(e.Categories, category{Term: t})
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// write дополняет ленту ссылками и датой обновления и отправляет её.
+func write(w http.ResponseWriter, r *http.Request, f feed, alternate string) {
+	f.ID = baseURL(r) + r.URL.Path
+	f.Links = []link{{Rel: "self", Href: f.ID}, {Rel: "alternate", Href: alternate}}
+	f.Updated = atomTime(time.Now())
+	if len(f.Entries) > 0 {
+		f.Updated = f.Entries[0].Updated
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(f); err != nil {
+		log.Printf("ошибка записи ленты: %v", err)
+	}
+}
+
+func storeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, bot_data.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	log.Printf("ошибка ленты: %v", err)
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+// tag - новые вопросы по тегу.
+func (h *handler) tag(w http.ResponseWriter, r *http.Request) {
+	tag, ok := feedName(r)
+	if !ok || tag == "" {
+		http.NotFound(w, r)
+		return
+	}
+	questions, _, err := h.store.ListQuestions(bot_data.QuestionFilter{Tag: tag, Order: bot_data.OrderNewest, Limit: feedEntries})
+	if err != nil {
+		storeError(w, r, err)
+		return
+	}
+	base := baseURL(r)
+	write(w, r, feed{
+		Title:   "QADots: #" + tag,
+		Entries: questionEntries(base, questions),
+	}, base+web.Prefix+"tags/"+url.PathEscape(tag))
+}
+
+// unanswered - открытые вопросы без ответов.
+func (h *handler) unanswered(w http.ResponseWriter, r *http.Request) {
+	questions, _, err := h.store.ListQuestions(bot_data.QuestionFilter{
+		OpenOnly:   true,
+		Unanswered: true,
+		Order:      bot_data.OrderNewest,
+		Limit:      feedEntries,
+	})
+	if err != nil {
+		storeError(w, r, err)
+		return
+	}
+	base := baseURL(r)
+	write(w, r, feed{
+		Title:   "QADots: вопросы без ответов",
+		Entries: questionEntries(base, questions),
+	}, base+web.Prefix)
+}
+
+// question - ответы на вопрос, новые сверху.
+func (h *handler) question(w http.ResponseWriter, r *http.Request) {
+	name, ok := feedName(r)
+	id, err := strconv.ParseInt(name, 10, 64)
+	if !ok || err != nil || id <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	q, err := h.store.Question(0, id)
+	if err != nil {
+		storeError(w, r, err)
+		return
+	}
+
+	answers := q.AnswerList
+	sort.Slice(answers, func(i, j int) bool { return answers[i].CreatedAt.After(answers[j].CreatedAt) })
+	if len(answers) > feedEntries {
+		answers = answers[:feedEntries]
+	}
+
+	base := baseURL(r)
+	page := questionURL(base, q.ID)
+	entries := make([]entry, 0, len(answers))
+	for _, a := range answers {
+		href := page + "#answer-" + strconv.FormatInt(a.ID, 10)
+		entries = append(entries, entry{
+			Title:     title(a.Text),
+			ID:        href,
+			Published: atomTime(a.CreatedAt),
+			Updated:   atomTime(a.CreatedAt),
+			Author:    authorName(a.Username, a.UserID),
+			Link:      link{Href: href},
+			Content:   content{Type: "html", Body: bot_data.RenderHTML(a.Text)},
+		})
+	}
+	write(w, r, feed{
+		Title:   "QADots: ответы на вопрос #" + strconv.FormatInt(q.ID, 10) + " " + title(q.Text),
+		Entries: entries,
+	}, page)
+}
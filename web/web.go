@@ -0,0 +1,225 @@
+package web
+
+import (
+	"QADots/bot_data"
+	"bytes"
+	"embed"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix - путь, под которым обслуживается веб-интерфейс. Корень занят вебхуком Telegram.
+const Prefix = "/web/"
+
+const (
+	tagsPerPage      = 50
+	questionsPerPage = 20
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+//go:embed static
+var staticFiles embed.FS
+
+// Store - источник данных веб-интерфейса. Его реализует bot_data.Bot.
+// Показывается только общее пространство, вопросы сообществ сюда не попадают.
+type Store interface {
+	ListQuestions(f bot_data.QuestionFilter) ([]bot_data.QuestionSummary, int, error)
+	Question(communityID, questionID int64) (bot_data.QuestionDetail, error)
+	ListTags(communityID int64, limit, offset int) ([]bot_data.TagSummary, int, error)
+}
+
+var funcs = template.FuncMap{
+	"content": func(text string) template.HTML {
+		return template.HTML(bot_data.RenderHTML(text))
+	},
+	"date": func(t time.Time) string {
+		return t.UTC().Format("02.01.2006 15:04 UTC")
+	},
+	"tagURL": func(tag string) string {
+		return Prefix + "tags/" + url.PathEscape(tag)
+	},
+	"questionURL": func(id int64) string {
+		return Prefix + "questions/" + strconv.FormatInt(id, 10)
+	},
+}
+
+// parsePage собирает страницу из общего шаблона layout.html и шаблона страницы.
+func parsePage(name string) *template.Template {
+	return template.Must(template.New("layout.html").Funcs(funcs).ParseFS(templateFiles, "templates/layout.html", "templates/"+name))
+}
+
+var (
+	tagsPage      = parsePage("tags.html")
+	questionsPage = parsePage("questions.html")
+	questionPage  = parsePage("question.html")
+	errorPage     = parsePage("error.html")
+)
+
+// Pager - данные для ссылок на соседние страницы.
+type Pager struct {
+	Page  int
+	Pages int
+	// Query - параметры запроса без page
+	Query string
+}
+
+func (p Pager) link(page int) string {
+	v, _ := url.ParseQuery(p.Query)
+	v.Set("page", strconv.Itoa(page))
+	return "?" + v.Encode()
+}
+
+func (p Pager) HasPrev() bool   { return p.Page > 1 }
+func (p Pager) HasNext() bool   { return p.Page < p.Pages }
+func (p Pager) PrevURL() string { return p.link(p.Page - 1) }
+func (p Pager) NextURL() string { return p.link(p.Page + 1) }
+
+func newPager(r *http.Request, page, perPage, total int) Pager {
+	v := r.URL.Query()
+	v.Del("page")
+	return Pager{Page: page, Pages: (total + perPage - 1) / perPage, Query: v.Encode()}
+}
+
+type questionsData struct {
+	Title string
+	// IsSearch - страница поиска, Search - строка поиска
+	IsSearch  bool
+	Search    string
+	Questions []bot_data.QuestionSummary
+	Pager     Pager
+}
+
+type handler struct {
+	store Store
+}
+
+// NewHandler возвращает обработчик всех путей веб-интерфейса.
+func NewHandler(s Store) http.Handler {
+	h := &handler{store: s}
+	static, _ := fs.Sub(staticFiles, "static")
+
+	mux := http.NewServeMux()
+	mux.Handle("GET "+Prefix+"static/", http.StripPrefix(Prefix+"static/", http.FileServer(http.FS(static))))
+	mux.HandleFunc("GET "+Prefix+"{$}", h.tags)
+	mux.HandleFunc("GET "+Prefix+"tags/{tag}", h.questions)
+	mux.HandleFunc("GET "+Prefix+"questions/{id}", h.question)
+	mux.HandleFunc("GET "+Prefix+"search", h.search)
+	mux.HandleFunc(Prefix, func(w http.ResponseWriter, r *http.Request) {
+		render(w, http.StatusNotFound, errorPage, "Страница не найдена")
+	})
+	return mux
+}
+
+// render выполняет шаблон в буфер, чтобы ошибка шаблона не оставила полстраницы.
+func render(w http.ResponseWriter, status int, t *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		log.Printf("ошибка шаблона веб-интерфейса: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+func renderStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, bot_data.ErrNotFound) {
+		render(w, http.StatusNotFound, errorPage, "Вопрос не найден")
+		return
+	}
+	log.Printf("ошибка веб-интерфейса: %v", err)
+	render(w, http.StatusInternalServerError, errorPage, "Ошибка. Попробуйте позже")
+}
+
+func pageParam(r *http.Request) int {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+func (h *handler) tags(w http.ResponseWriter, r *http.Request) {
+	page := pageParam(r)
+	tags, total, err := h.store.ListTags(0, tagsPerPage, (page-1)*tagsPerPage)
+	if err != nil {
+		renderStoreError(w, err)
+		return
+	}
+	render(w, http.StatusOK, tagsPage, struct {
+		Tags  []bot_data.TagSummary
+		Pager Pager
+	}{tags, newPager(r, page, tagsPerPage, total)})
+}
+
+// questions - вопросы по тегу в том же порядке, что и в /questions.
+func (h *handler) questions(w http.ResponseWriter, r *http.Request) {
+	tag := r.PathValue("tag")
+	page := pageParam(r)
+	questions, total, err := h.store.ListQuestions(bot_data.QuestionFilter{
+		Tag:      tag,
+		OpenOnly: true,
+		Order:    bot_data.OrderLikes,
+		Limit:    questionsPerPage,
+		Offset:   (page - 1) * questionsPerPage,
+	})
+	if err != nil {
+		renderStoreError(w, err)
+		return
+	}
+	render(w, http.StatusOK, questionsPage, questionsData{
+		Title:     "#" + tag,
+		Questions: questions,
+		Pager:     newPager(r, page, questionsPerPage, total),
+	})
+}
+
+func (h *handler) search(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	page := pageParam(r)
+	var questions []bot_data.QuestionSummary
+	total := 0
+	if query != "" {
+		var err error
+		questions, total, err = h.store.ListQuestions(bot_data.QuestionFilter{
+			Query:  query,
+			Limit:  questionsPerPage,
+			Offset: (page - 1) * questionsPerPage,
+		})
+		if err != nil {
+			renderStoreError(w, err)
+			return
+		}
+	}
+	render(w, http.StatusOK, questionsPage, questionsData{
+		Title:     "Поиск",
+		IsSearch:  true,
+		Search:    query,
+		Questions: questions,
+		Pager:     newPager(r, page, questionsPerPage, total),
+	})
+}
+
+func (h *handler) question(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		render(w, http.StatusNotFound, errorPage, "Вопрос не найден")
+		return
+	}
+	q, err := h.store.Question(0, id)
+	if err != nil {
+		renderStoreError(w, err)
+		return
+	}
+	render(w, http.StatusOK, questionPage, q)
+}